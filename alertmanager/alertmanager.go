@@ -0,0 +1,322 @@
+// Package alertmanager receives Prometheus Alertmanager webhooks and
+// reflects firing alerts as whooktown building status.
+package alertmanager
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	whooktown "github.com/fredericalix/whooktown-golang-sdk"
+	"github.com/gofrs/uuid"
+)
+
+// maxPayloadSize bounds the size of an accepted webhook body
+const maxPayloadSize = 4 << 20
+
+// Payload is an Alertmanager webhook payload (version 4)
+type Payload struct {
+	Version           string            `json:"version"`
+	GroupKey          string            `json:"groupKey"`
+	Status            string            `json:"status"`
+	Receiver          string            `json:"receiver"`
+	GroupLabels       map[string]string `json:"groupLabels"`
+	CommonLabels      map[string]string `json:"commonLabels"`
+	CommonAnnotations map[string]string `json:"commonAnnotations"`
+	ExternalURL       string            `json:"externalURL"`
+	Alerts            []Alert           `json:"alerts"`
+}
+
+// Alert is a single alert of a webhook payload
+type Alert struct {
+	Status       string            `json:"status"` // firing or resolved
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+}
+
+// key identifies an alert, falling back to a hash of its labels
+func (a *Alert) key() string {
+	if a.Fingerprint != "" {
+		return a.Fingerprint
+	}
+	names := make([]string, 0, len(a.Labels))
+	for name := range a.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	h := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(h, "%s\x00%s\x00", name, a.Labels[name])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Config configures a receiver
+type Config struct {
+	// SensorLabel is the alert label identifying the building (default: "whooktown_sensor")
+	SensorLabel string
+
+	// Sensors maps SensorLabel values to sensor IDs. When empty, the label
+	// value itself must be a sensor UUID.
+	Sensors map[string]uuid.UUID
+
+	// SeverityLabel is the alert label holding the severity (default: "severity")
+	SeverityLabel string
+
+	// Severities maps severity values to statuses. Defaults:
+	// critical, error and page map to critical; warning maps to warning.
+	Severities map[string]whooktown.Status
+
+	// DefaultStatus is used for unknown severities (default: warning)
+	DefaultStatus whooktown.Status
+
+	// Token, if set, must be sent as a Bearer token
+	Token string
+
+	// Popup and LayoutID, if set, open the detail popup of buildings that become critical
+	Popup    *whooktown.PopupClient
+	LayoutID string
+
+	// OnError is called when an alert cannot be mapped or a popup fails
+	OnError func(err error)
+}
+
+// Receiver is an http.Handler translating Alertmanager webhooks into sensor updates.
+// It tracks firing alerts per sensor so that a resolution restores the worst
+// remaining status.
+type Receiver struct {
+	sensors whooktown.SensorSender
+	config  Config
+
+	mu      sync.Mutex
+	firing  map[uuid.UUID]map[string]firingAlert
+	sent    map[uuid.UUID]whooktown.Status // last status sent successfully
+	sending map[uuid.UUID]*sync.Mutex      // serializes the sends of a sensor
+}
+
+// firingAlert is a tracked firing alert and its mapped status
+type firingAlert struct {
+	alert  Alert
+	status whooktown.Status
+}
+
+// New creates a receiver sending updates to sensors
+func New(sensors whooktown.SensorSender, config Config) *Receiver {
+	if config.SensorLabel == "" {
+		config.SensorLabel = "whooktown_sensor"
+	}
+	if config.SeverityLabel == "" {
+		config.SeverityLabel = "severity"
+	}
+	if config.Severities == nil {
+		config.Severities = map[string]whooktown.Status{
+			"critical": whooktown.StatusCritical,
+			"error":    whooktown.StatusCritical,
+			"page":     whooktown.StatusCritical,
+			"warning":  whooktown.StatusWarning,
+		}
+	}
+	if config.DefaultStatus == "" {
+		config.DefaultStatus = whooktown.StatusWarning
+	}
+	return &Receiver{
+		sensors: sensors,
+		config:  config,
+		firing:  make(map[uuid.UUID]map[string]firingAlert),
+		sent:    make(map[uuid.UUID]whooktown.Status),
+		sending: make(map[uuid.UUID]*sync.Mutex),
+	}
+}
+
+// ServeHTTP implements http.Handler
+func (r *Receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.config.Token != "" {
+		want := "Bearer " + r.config.Token
+		if subtle.ConstantTimeCompare([]byte(req.Header.Get("Authorization")), []byte(want)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	var payload Payload
+	if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxPayloadSize)).Decode(&payload); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	// A non-2xx response makes Alertmanager retry the notification
+	if err := r.Process(req.Context(), &payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Process applies a webhook payload and sends the resulting status of every
+// affected sensor. A sensor whose status becomes critical compared to the last
+// status sent successfully opens the detail popup, so a failed send that
+// Alertmanager retries still escalates.
+func (r *Receiver) Process(ctx context.Context, payload *Payload) error {
+	r.mu.Lock()
+	seen := make(map[uuid.UUID]bool)
+	var touched []uuid.UUID
+	for _, a := range payload.Alerts {
+		id, err := r.sensorID(&a)
+		if err != nil {
+			r.reportError(err)
+			continue
+		}
+		if !seen[id] {
+			seen[id] = true
+			touched = append(touched, id)
+		}
+
+		alerts := r.firing[id]
+		if a.Status == "resolved" {
+			delete(alerts, a.key())
+			if len(alerts) == 0 {
+				delete(r.firing, id)
+			}
+			continue
+		}
+		if alerts == nil {
+			alerts = make(map[string]firingAlert)
+			r.firing[id] = alerts
+		}
+		alerts[a.key()] = firingAlert{alert: a, status: r.severityStatus(&a)}
+	}
+	r.mu.Unlock()
+
+	var errs []error
+	var escalated []string
+	for _, id := range touched {
+		ok, err := r.send(ctx, id)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if ok {
+			escalated = append(escalated, id.String())
+		}
+	}
+
+	if len(escalated) > 0 && r.config.Popup != nil && r.config.LayoutID != "" {
+		if err := r.config.Popup.ShowDetail(ctx, r.config.LayoutID, escalated); err != nil {
+			r.reportError(err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// send sends the current status of a sensor and reports whether it
+// escalated to critical. Sends of a sensor are serialized and read the
+// status when they start, so a concurrent payload cannot overwrite a newer
+// status with an older one.
+func (r *Receiver) send(ctx context.Context, id uuid.UUID) (bool, error) {
+	r.mu.Lock()
+	lock, ok := r.sending[id]
+	if !ok {
+		lock = new(sync.Mutex)
+		r.sending[id] = lock
+	}
+	r.mu.Unlock()
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	r.mu.Lock()
+	status := r.statusLocked(id)
+	previous := r.sent[id]
+	r.mu.Unlock()
+
+	if err := r.sensors.Send(ctx, &whooktown.SensorData{ID: id, Status: status}); err != nil {
+		return false, err
+	}
+
+	r.mu.Lock()
+	r.sent[id] = status
+	r.mu.Unlock()
+	return status == whooktown.StatusCritical && previous != whooktown.StatusCritical, nil
+}
+
+// Status returns the status derived from the alerts currently firing for a sensor
+func (r *Receiver) Status(id uuid.UUID) whooktown.Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.statusLocked(id)
+}
+
+// Firing returns the alerts currently firing for a sensor
+func (r *Receiver) Firing(id uuid.UUID) []Alert {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	alerts := make([]Alert, 0, len(r.firing[id]))
+	for _, fa := range r.firing[id] {
+		alerts = append(alerts, fa.alert)
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		return alerts[i].StartsAt.Before(alerts[j].StartsAt)
+	})
+	return alerts
+}
+
+// statusLocked returns the worst firing status of a sensor, or online if none
+func (r *Receiver) statusLocked(id uuid.UUID) whooktown.Status {
+	status := whooktown.StatusOnline
+	for _, fa := range r.firing[id] {
+		status = whooktown.WorstStatus(status, fa.status)
+	}
+	return status
+}
+
+// sensorID resolves the sensor targeted by an alert
+func (r *Receiver) sensorID(a *Alert) (uuid.UUID, error) {
+	value, ok := a.Labels[r.config.SensorLabel]
+	if !ok {
+		return uuid.Nil, whooktown.NewError(whooktown.ErrValidation, fmt.Sprintf("alert %s has no %s label", a.Labels["alertname"], r.config.SensorLabel))
+	}
+	if len(r.config.Sensors) > 0 {
+		id, ok := r.config.Sensors[value]
+		if !ok {
+			return uuid.Nil, whooktown.NewError(whooktown.ErrValidation, fmt.Sprintf("no sensor mapped to %s=%s", r.config.SensorLabel, value))
+		}
+		return id, nil
+	}
+	id, err := uuid.FromString(value)
+	if err != nil {
+		return uuid.Nil, whooktown.NewErrorWithCause(whooktown.ErrValidation, fmt.Sprintf("invalid sensor id %q", value), err)
+	}
+	return id, nil
+}
+
+// severityStatus maps the severity label of an alert to a status
+func (r *Receiver) severityStatus(a *Alert) whooktown.Status {
+	if status, ok := r.config.Severities[a.Labels[r.config.SeverityLabel]]; ok {
+		return status
+	}
+	return r.config.DefaultStatus
+}
+
+// reportError forwards an error to the configured handler
+func (r *Receiver) reportError(err error) {
+	if r.config.OnError != nil {
+		r.config.OnError(err)
+	}
+}
@@ -0,0 +1,228 @@
+package whooktown
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// Band aggregates over the rolling window
+const (
+	BandAvg  = "avg"
+	BandMin  = "min"
+	BandMax  = "max"
+	BandLast = "last"
+	BandP95  = "p95"
+)
+
+// BandSeries is a named time series shown as one MonitorTube band
+type BandSeries struct {
+	Name string `json:"name"`
+
+	// Min and Max scale values to 0-100. When Max is not above Min, the
+	// scale auto-ranges from Min to the highest value in the window.
+	Min float64 `json:"min,omitempty"`
+	Max float64 `json:"max,omitempty"`
+}
+
+// BandConfig configures a MonitorTube band aggregator
+type BandConfig struct {
+	SensorID uuid.UUID
+
+	// Series are the bands, in display order (3-7)
+	Series []BandSeries
+
+	// Window is the rolling window aggregated into each band (default: 1m)
+	Window time.Duration
+
+	// Aggregate is avg, min, max, last or p95 (default: avg)
+	Aggregate string
+
+	// Interval between updates sent by Run (default: 10s)
+	Interval time.Duration
+
+	// OnError is called when an update fails to send
+	OnError func(err error)
+}
+
+// BandAggregator turns named time series into MonitorTube band updates
+type BandAggregator struct {
+	sensors SensorSender
+	config  BandConfig
+
+	mu      sync.Mutex
+	samples map[string][]bandSample
+}
+
+// bandSample is a single observation
+type bandSample struct {
+	at    time.Time
+	value float64
+}
+
+// NewBandAggregator validates the configuration and creates an aggregator sending to sensors
+func NewBandAggregator(sensors SensorSender, config BandConfig) (*BandAggregator, error) {
+	if n := len(config.Series); n < 3 || n > 7 {
+		return nil, NewError(ErrValidation, fmt.Sprintf("monitor tube needs 3 to 7 bands, got %d", n))
+	}
+	names := make(map[string]bool, len(config.Series))
+	for _, s := range config.Series {
+		if s.Name == "" || names[s.Name] {
+			return nil, NewError(ErrValidation, fmt.Sprintf("band names must be unique and non-empty: %q", s.Name))
+		}
+		names[s.Name] = true
+	}
+	switch config.Aggregate {
+	case "":
+		config.Aggregate = BandAvg
+	case BandAvg, BandMin, BandMax, BandLast, BandP95:
+	default:
+		return nil, NewError(ErrValidation, fmt.Sprintf("unknown band aggregate %q", config.Aggregate))
+	}
+	if config.Window <= 0 {
+		config.Window = time.Minute
+	}
+	if config.Interval <= 0 {
+		config.Interval = 10 * time.Second
+	}
+	return &BandAggregator{
+		sensors: sensors,
+		config:  config,
+		samples: make(map[string][]bandSample),
+	}, nil
+}
+
+// Observe adds a value to a series. Unknown series are ignored.
+func (a *BandAggregator) Observe(name string, value float64) {
+	a.ObserveAt(name, time.Now(), value)
+}
+
+// ObserveAt adds a value observed at a given time to a series
+func (a *BandAggregator) ObserveAt(name string, at time.Time, value float64) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, s := range a.config.Series {
+		if s.Name == name {
+			samples := append(a.samples[name], bandSample{at: at, value: value})
+			if n := len(samples); n > 1 && at.Before(samples[n-2].at) {
+				sort.SliceStable(samples, func(i, j int) bool {
+					return samples[i].at.Before(samples[j].at)
+				})
+			}
+			a.samples[name] = samples
+			return
+		}
+	}
+}
+
+// Bands returns the current band values, one per series in order.
+// Series without samples in the window are 0.
+func (a *BandAggregator) Bands() []Band {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	cutoff := time.Now().Add(-a.config.Window)
+	bands := make([]Band, len(a.config.Series))
+	for i, s := range a.config.Series {
+		samples := a.samples[s.Name]
+		start := sort.Search(len(samples), func(j int) bool {
+			return samples[j].at.After(cutoff)
+		})
+		samples = samples[start:]
+		a.samples[s.Name] = samples
+
+		bands[i] = Band{Name: s.Name}
+		if len(samples) == 0 {
+			continue
+		}
+		v := a.aggregate(samples)
+		bands[i].Value = scaleBand(s, v, samples)
+	}
+	return bands
+}
+
+// SensorData returns a MonitorTube update with the current bands
+func (a *BandAggregator) SensorData() *SensorData {
+	bands := a.Bands()
+	return &SensorData{
+		ID:        a.config.SensorID,
+		BandCount: len(bands),
+		Bands:     bands,
+	}
+}
+
+// Flush sends the current bands
+func (a *BandAggregator) Flush(ctx context.Context) {
+	if err := a.sensors.Send(ctx, a.SensorData()); err != nil && a.config.OnError != nil {
+		a.config.OnError(err)
+	}
+}
+
+// Run sends the bands every Interval until the context is cancelled
+func (a *BandAggregator) Run(ctx context.Context) error {
+	ticker := time.NewTicker(a.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			a.Flush(ctx)
+		}
+	}
+}
+
+// aggregate reduces the window samples of a series
+func (a *BandAggregator) aggregate(samples []bandSample) float64 {
+	switch a.config.Aggregate {
+	case BandLast:
+		return samples[len(samples)-1].value
+	case BandMin, BandMax:
+		v := samples[0].value
+		for _, s := range samples[1:] {
+			if a.config.Aggregate == BandMin {
+				v = min(v, s.value)
+			} else {
+				v = max(v, s.value)
+			}
+		}
+		return v
+	case BandP95:
+		values := make([]float64, len(samples))
+		for i, s := range samples {
+			values[i] = s.value
+		}
+		sort.Float64s(values)
+		return values[int(math.Ceil(0.95*float64(len(values))))-1]
+	}
+	sum := 0.0
+	for _, s := range samples {
+		sum += s.value
+	}
+	return sum / float64(len(samples))
+}
+
+// scaleBand maps an aggregate to 0-100. Auto-ranged series scale to the
+// highest value of the window samples.
+func scaleBand(s BandSeries, v float64, samples []bandSample) int {
+	hi := s.Max
+	if hi <= s.Min {
+		hi = samples[0].value
+		for _, sample := range samples[1:] {
+			hi = max(hi, sample.value)
+		}
+	}
+	if hi <= s.Min {
+		return 0
+	}
+	return int(math.Round(max(0, min(100, (v-s.Min)/(hi-s.Min)*100))))
+}
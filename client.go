@@ -62,7 +62,7 @@ func New(opts ...Option) (*Client, error) {
 
 	// Initialize service clients
 	c.Auth = &AuthClient{http: authHTTP}
-	c.Sensors = &SensorsClient{http: sensorHTTP}
+	c.Sensors = &SensorsClient{http: sensorHTTP, policy: cfg.StatusPolicy}
 	c.UI = &UIClient{http: uiHTTP}
 	c.Camera = &CameraClient{http: uiHTTP}
 	c.Traffic = &TrafficClient{http: uiHTTP}
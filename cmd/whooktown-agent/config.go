@@ -0,0 +1,548 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	whooktown "github.com/fredericalix/whooktown-golang-sdk"
+	"github.com/fredericalix/whooktown-golang-sdk/hostmetrics"
+	"github.com/fredericalix/whooktown-golang-sdk/kpi"
+	"github.com/fredericalix/whooktown-golang-sdk/nagios"
+	"github.com/fredericalix/whooktown-golang-sdk/probe"
+	"github.com/fredericalix/whooktown-golang-sdk/procwatch"
+	"github.com/fredericalix/whooktown-golang-sdk/prometheus"
+	"github.com/gofrs/uuid"
+)
+
+// Config is the agent configuration file
+type Config struct {
+	// Credentials: Token, else the content of TokenFile, else WHOOKTOWN_TOKEN
+	Token       string                `json:"token,omitempty"`
+	TokenFile   string                `json:"token_file,omitempty"`
+	Environment whooktown.Environment `json:"environment,omitempty"`
+
+	// SensorURL overrides the sensor API URL, e.g. to send through a relay
+	SensorURL string `json:"sensor_url,omitempty"`
+
+	// Listen is the address of the health and state endpoint (default: 127.0.0.1:9465).
+	// Changing it requires a restart.
+	Listen string `json:"listen,omitempty"`
+
+	// Namespace derives sensor IDs from names (default: whooktown.NamespaceWhooktown)
+	Namespace uuid.UUID `json:"namespace,omitempty"`
+
+	// Names maps sensor names to explicit IDs
+	Names map[string]uuid.UUID `json:"names,omitempty"`
+
+	// Interval and Timeout are the collector defaults (default: 30s and 10s)
+	Interval duration `json:"interval,omitempty"`
+	Timeout  duration `json:"timeout,omitempty"`
+
+	// Policy is applied to every update that does not set its own status
+	Policy *whooktown.StatusPolicy `json:"policy,omitempty"`
+
+	Collectors []CollectorSpec `json:"collectors"`
+}
+
+// CollectorSpec describes one collector and the sensor it feeds
+type CollectorSpec struct {
+	Name string `json:"name"`
+
+	// Type is hostmetrics, http, tcp, dns, tls, nagios, prometheus, kpi or procwatch
+	Type string `json:"type"`
+
+	// Sensor is a sensor ID or a name resolved through Names and Namespace.
+	// prometheus and kpi mappings set their own sensor_id, or a sensor name
+	// resolved the same way.
+	Sensor string `json:"sensor,omitempty"`
+
+	Interval duration `json:"interval,omitempty"`
+	Timeout  duration `json:"timeout,omitempty"`
+
+	// Policy is applied to the updates of this collector, before the global one
+	Policy *whooktown.StatusPolicy `json:"policy,omitempty"`
+
+	// Options are specific to the type
+	Options json.RawMessage `json:"options,omitempty"`
+}
+
+// duration is a time.Duration read from a string such as "30s"
+type duration time.Duration
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"30s\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+// loadConfig reads and validates a JSON configuration file
+func loadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config Config
+	if err := decodeStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if config.Environment == "" {
+		config.Environment = whooktown.Environment(os.Getenv("WHOOKTOWN_ENV"))
+	}
+	if config.Environment == "" {
+		config.Environment = whooktown.EnvProduction
+	}
+	if config.Listen == "" {
+		config.Listen = "127.0.0.1:9465"
+	}
+	if config.Namespace == uuid.Nil {
+		config.Namespace = whooktown.NamespaceWhooktown
+	}
+	if config.Interval <= 0 {
+		config.Interval = duration(30 * time.Second)
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = duration(10 * time.Second)
+	}
+	if config.Policy != nil {
+		if err := config.Policy.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	seen := make(map[string]bool, len(config.Collectors))
+	for i := range config.Collectors {
+		spec := &config.Collectors[i]
+		if spec.Name == "" || seen[spec.Name] {
+			return nil, fmt.Errorf("collector names must be unique and non-empty: %q", spec.Name)
+		}
+		seen[spec.Name] = true
+		if spec.Interval <= 0 {
+			spec.Interval = config.Interval
+		}
+		if spec.Timeout <= 0 {
+			spec.Timeout = config.Timeout
+		}
+		if spec.Policy != nil {
+			if err := spec.Policy.Validate(); err != nil {
+				return nil, fmt.Errorf("collector %s: %w", spec.Name, err)
+			}
+		}
+	}
+	return &config, nil
+}
+
+// token returns the API token of the configuration
+func (c *Config) token() (string, error) {
+	switch {
+	case c.Token != "":
+		return c.Token, nil
+	case c.TokenFile != "":
+		data, err := os.ReadFile(c.TokenFile)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	case os.Getenv("WHOOKTOWN_TOKEN") != "":
+		return os.Getenv("WHOOKTOWN_TOKEN"), nil
+	}
+	return "", errors.New("token, token_file or WHOOKTOWN_TOKEN is required")
+}
+
+// registry returns the sensor name registry of the configuration
+func (c *Config) registry() (*whooktown.Registry, error) {
+	names := whooktown.NewRegistry(c.Namespace)
+	for name, id := range c.Names {
+		if err := names.Register(name, id); err != nil {
+			return nil, err
+		}
+	}
+	return names, nil
+}
+
+// key identifies a collector configuration: collectors whose key is
+// unchanged across a reload keep running with their state
+func (s *CollectorSpec) key(sensorID uuid.UUID, config *Config) (string, error) {
+	// Options are re-encoded so that formatting changes do not count
+	var options interface{}
+	if len(s.Options) > 0 {
+		if err := json.Unmarshal(s.Options, &options); err != nil {
+			return "", fmt.Errorf("collector %s: invalid options: %w", s.Name, err)
+		}
+	}
+	spec := *s
+	spec.Options = nil
+	// The sensor names of prometheus and kpi mappings are resolved by the collector
+	var names interface{}
+	if s.Type == "prometheus" || s.Type == "kpi" {
+		names = []interface{}{config.Namespace, config.Names}
+	}
+	data, err := json.Marshal(struct {
+		Spec     CollectorSpec
+		Options  interface{}
+		SensorID uuid.UUID
+		Names    interface{}
+	}{spec, options, sensorID, names})
+	if err != nil {
+		return "", fmt.Errorf("collector %s: %w", s.Name, err)
+	}
+	return string(data), nil
+}
+
+// sensorID resolves the Sensor of a spec
+func (s *CollectorSpec) sensorID(names *whooktown.Registry) uuid.UUID {
+	if s.Sensor == "" {
+		return uuid.Nil
+	}
+	if id, err := uuid.FromString(s.Sensor); err == nil {
+		return id
+	}
+	return names.ID(s.Sensor)
+}
+
+// probeOptions are the options of the http, tcp, dns and tls types
+type probeOptions struct {
+	// http
+	URL            string            `json:"url,omitempty"`
+	Method         string            `json:"method,omitempty"`
+	Headers        map[string]string `json:"headers,omitempty"`
+	Body           string            `json:"body,omitempty"`
+	ExpectedStatus int               `json:"expected_status,omitempty"`
+	BodyRegex      string            `json:"body_regex,omitempty"`
+
+	// tcp and tls
+	Address string `json:"address,omitempty"`
+
+	// dns
+	Host     string   `json:"host,omitempty"`
+	Expected []string `json:"expected,omitempty"`
+	Server   string   `json:"server,omitempty"`
+
+	// tls
+	ServerName         string `json:"server_name,omitempty"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty"`
+	WarningDays        int    `json:"warning_days,omitempty"`
+	CriticalDays       int    `json:"critical_days,omitempty"`
+
+	// Latency thresholds of http, tcp and dns
+	Warning   duration `json:"warning,omitempty"`
+	Critical  duration `json:"critical,omitempty"`
+	FastBelow duration `json:"fast_below,omitempty"`
+	SlowAbove duration `json:"slow_above,omitempty"`
+
+	TextField probe.TextField `json:"text_field,omitempty"`
+}
+
+// nagiosOptions are the options of the nagios type
+type nagiosOptions struct {
+	Command []string `json:"command"`
+	Dir     string   `json:"dir,omitempty"`
+	Env     []string `json:"env,omitempty"`
+	Fields  []struct {
+		Label     string `json:"label"`
+		Field     string `json:"field"`
+		Normalize bool   `json:"normalize,omitempty"`
+	} `json:"fields,omitempty"`
+	Bands     []string `json:"bands,omitempty"`
+	TextField string   `json:"text_field,omitempty"`
+}
+
+// hostOptions are the options of the hostmetrics type
+type hostOptions struct {
+	ProcRoot   string   `json:"proc_root,omitempty"`
+	LinkSpeed  uint64   `json:"link_speed,omitempty"`
+	Interfaces []string `json:"interfaces,omitempty"`
+}
+
+// procOptions are the options of the procwatch type.
+// Processes without a sensor_id report to the collector sensor.
+type procOptions struct {
+	ProcRoot  string              `json:"proc_root,omitempty"`
+	Processes []procwatch.Process `json:"processes"`
+}
+
+// newCollector builds the collector described by a spec and returns the
+// sensors it feeds
+func newCollector(spec *CollectorSpec, sensorID uuid.UUID, names *whooktown.Registry) (whooktown.Collector, []uuid.UUID, error) {
+	info := whooktown.CollectorInfo{
+		Name:        spec.Name,
+		Description: spec.Type,
+		Interval:    time.Duration(spec.Interval),
+		Timeout:     time.Duration(spec.Timeout),
+	}
+	needSensor := func() error {
+		if sensorID == uuid.Nil {
+			return fmt.Errorf("collector %s: sensor is required", spec.Name)
+		}
+		return nil
+	}
+
+	var collect func(ctx context.Context) ([]whooktown.SensorData, error)
+	var sensors []uuid.UUID
+	switch spec.Type {
+	case "hostmetrics":
+		var opts hostOptions
+		if err := decodeOptions(spec, &opts); err != nil {
+			return nil, nil, err
+		}
+		if err := needSensor(); err != nil {
+			return nil, nil, err
+		}
+		sensors = []uuid.UUID{sensorID}
+		collect = hostmetrics.New(nil, hostmetrics.Config{
+			SensorID:   sensorID,
+			ProcRoot:   opts.ProcRoot,
+			LinkSpeed:  opts.LinkSpeed,
+			Interfaces: opts.Interfaces,
+		}).Collect
+
+	case "http", "tcp", "dns", "tls":
+		var opts probeOptions
+		if err := decodeOptions(spec, &opts); err != nil {
+			return nil, nil, err
+		}
+		if err := needSensor(); err != nil {
+			return nil, nil, err
+		}
+		sensors = []uuid.UUID{sensorID}
+		check, err := newProbe(spec, sensorID, &opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		collect = func(ctx context.Context) ([]whooktown.SensorData, error) {
+			r := check.Probe(ctx)
+			return []whooktown.SensorData{*r.SensorData()}, nil
+		}
+
+	case "nagios":
+		var opts nagiosOptions
+		if err := decodeOptions(spec, &opts); err != nil {
+			return nil, nil, err
+		}
+		if err := needSensor(); err != nil {
+			return nil, nil, err
+		}
+		sensors = []uuid.UUID{sensorID}
+		check := &nagios.Check{
+			Name:      spec.Name,
+			SensorID:  sensorID,
+			Command:   opts.Command,
+			Dir:       opts.Dir,
+			Env:       opts.Env,
+			Timeout:   time.Duration(spec.Timeout),
+			Bands:     opts.Bands,
+			TextField: opts.TextField,
+		}
+		for _, f := range opts.Fields {
+			check.Fields = append(check.Fields, nagios.FieldMapping{Label: f.Label, Field: f.Field, Normalize: f.Normalize})
+		}
+		if err := check.Validate(); err != nil {
+			return nil, nil, err
+		}
+		// The plugin bounds its own run; a timeout is reported as UNKNOWN
+		info.Timeout = time.Duration(spec.Timeout) + 5*time.Second
+		collect = func(ctx context.Context) ([]whooktown.SensorData, error) {
+			r := check.Run(ctx)
+			return []whooktown.SensorData{*r.SensorData()}, r.Err
+		}
+
+	case "prometheus":
+		var opts prometheus.Config
+		if err := decodeOptions(spec, &struct {
+			Targets *[]prometheus.Target `json:"targets"`
+		}{&opts.Targets}); err != nil {
+			return nil, nil, err
+		}
+		opts.Timeout = time.Duration(spec.Timeout)
+		opts.Names = names
+		for _, t := range opts.Targets {
+			for _, m := range t.Mappings {
+				sensors = append(sensors, mappingSensor(m.SensorID, m.Sensor, names))
+			}
+		}
+		scraper, err := prometheus.New(nil, opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		collect = scraper.Collect
+
+	case "kpi":
+		var opts kpi.Config
+		if err := decodeOptions(spec, &struct {
+			Endpoints *[]kpi.Endpoint `json:"endpoints"`
+		}{&opts.Endpoints}); err != nil {
+			return nil, nil, err
+		}
+		opts.Timeout = time.Duration(spec.Timeout)
+		opts.Names = names
+		for _, e := range opts.Endpoints {
+			for _, m := range e.Mappings {
+				sensors = append(sensors, mappingSensor(m.SensorID, m.Sensor, names))
+			}
+		}
+		poller, err := kpi.New(nil, opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		collect = poller.Collect
+
+	case "procwatch":
+		var opts procOptions
+		if err := decodeOptions(spec, &opts); err != nil {
+			return nil, nil, err
+		}
+		for i := range opts.Processes {
+			if opts.Processes[i].SensorID == uuid.Nil {
+				opts.Processes[i].SensorID = sensorID
+			}
+			if opts.Processes[i].SensorID != uuid.Nil {
+				sensors = append(sensors, opts.Processes[i].SensorID)
+			}
+		}
+		watcher, err := procwatch.New(nil, procwatch.Config{
+			ProcRoot:  opts.ProcRoot,
+			Processes: opts.Processes,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		collect = func(ctx context.Context) ([]whooktown.SensorData, error) {
+			var updates []whooktown.SensorData
+			for _, r := range watcher.Check(ctx) {
+				if r.SensorID != uuid.Nil {
+					updates = append(updates, *r.SensorData())
+				}
+			}
+			return updates, nil
+		}
+
+	default:
+		return nil, nil, fmt.Errorf("collector %s: unknown type %q", spec.Name, spec.Type)
+	}
+
+	if spec.Policy != nil {
+		policy := spec.Policy
+		inner := collect
+		collect = func(ctx context.Context) ([]whooktown.SensorData, error) {
+			updates, err := inner(ctx)
+			for i := range updates {
+				policy.Apply(&updates[i])
+			}
+			return updates, err
+		}
+	}
+	return whooktown.NewCollector(info, collect), sensors, nil
+}
+
+// mappingSensor resolves the sensor of a prometheus or kpi mapping as the
+// collector does
+func mappingSensor(id uuid.UUID, name string, names *whooktown.Registry) uuid.UUID {
+	if id == uuid.Nil && name != "" {
+		return names.ID(name)
+	}
+	return id
+}
+
+// newProbe builds the probe check of an http, tcp, dns or tls spec
+func newProbe(spec *CollectorSpec, sensorID uuid.UUID, opts *probeOptions) (probe.Check, error) {
+	var check interface {
+		probe.Check
+		Validate() error
+	}
+	switch spec.Type {
+	case "http":
+		check = &probe.HTTPCheck{
+			Name:           spec.Name,
+			SensorID:       sensorID,
+			TextField:      opts.TextField,
+			URL:            opts.URL,
+			Method:         opts.Method,
+			Headers:        opts.Headers,
+			Body:           opts.Body,
+			ExpectedStatus: opts.ExpectedStatus,
+			BodyRegex:      opts.BodyRegex,
+			Timeout:        time.Duration(spec.Timeout),
+			Warning:        time.Duration(opts.Warning),
+			Critical:       time.Duration(opts.Critical),
+			FastBelow:      time.Duration(opts.FastBelow),
+			SlowAbove:      time.Duration(opts.SlowAbove),
+		}
+	case "tcp":
+		check = &probe.TCPCheck{
+			Name:      spec.Name,
+			SensorID:  sensorID,
+			TextField: opts.TextField,
+			Address:   opts.Address,
+			Timeout:   time.Duration(spec.Timeout),
+			Warning:   time.Duration(opts.Warning),
+			Critical:  time.Duration(opts.Critical),
+			FastBelow: time.Duration(opts.FastBelow),
+			SlowAbove: time.Duration(opts.SlowAbove),
+		}
+	case "dns":
+		check = &probe.DNSCheck{
+			Name:      spec.Name,
+			SensorID:  sensorID,
+			TextField: opts.TextField,
+			Host:      opts.Host,
+			Expected:  opts.Expected,
+			Server:    opts.Server,
+			Timeout:   time.Duration(spec.Timeout),
+			Warning:   time.Duration(opts.Warning),
+			Critical:  time.Duration(opts.Critical),
+			FastBelow: time.Duration(opts.FastBelow),
+			SlowAbove: time.Duration(opts.SlowAbove),
+		}
+	case "tls":
+		check = &probe.TLSCheck{
+			Name:               spec.Name,
+			SensorID:           sensorID,
+			TextField:          opts.TextField,
+			Address:            opts.Address,
+			ServerName:         opts.ServerName,
+			InsecureSkipVerify: opts.InsecureSkipVerify,
+			Timeout:            time.Duration(spec.Timeout),
+			WarningDays:        opts.WarningDays,
+			CriticalDays:       opts.CriticalDays,
+		}
+	}
+	if err := check.Validate(); err != nil {
+		return nil, err
+	}
+	return check, nil
+}
+
+// decodeOptions decodes the options of a spec, rejecting unknown fields
+func decodeOptions(spec *CollectorSpec, v interface{}) error {
+	if len(spec.Options) == 0 {
+		return nil
+	}
+	if err := decodeStrict(spec.Options, v); err != nil {
+		return fmt.Errorf("collector %s: invalid options: %w", spec.Name, err)
+	}
+	return nil
+}
+
+// decodeStrict decodes JSON, rejecting unknown fields to catch typos
+func decodeStrict(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
@@ -0,0 +1,384 @@
+// Command whooktown-agent runs the collectors described in a JSON
+// configuration file and sends their updates to whooktown. YAML is not
+// supported; convert it to JSON first.
+//
+//	whooktown-agent [--config /etc/whooktown/agent.json] [--check]
+//
+// SIGHUP reloads the configuration: collectors whose configuration is
+// unchanged keep running with their state, others are started, restarted or
+// stopped. An invalid configuration is reported and the running one is kept.
+//
+// GET /health on the listen address reports the agent and collector status;
+// GET /state returns the last update sent to each sensor.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	whooktown "github.com/fredericalix/whooktown-golang-sdk"
+	"github.com/gofrs/uuid"
+)
+
+func main() {
+	configPath := flag.String("config", "/etc/whooktown/agent.json", "configuration file")
+	check := flag.Bool("check", false, "validate the configuration and exit")
+	flag.Parse()
+
+	config, err := loadConfig(*configPath)
+	if err == nil {
+		_, err = build(config)
+	}
+	if err != nil {
+		log.Fatalf("whooktown-agent: %v", err)
+	}
+	if *check {
+		fmt.Printf("%s: %d collectors\n", *configPath, len(config.Collectors))
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	a := newAgent(*configPath)
+	if err := a.apply(config); err != nil {
+		log.Fatalf("whooktown-agent: %v", err)
+	}
+
+	server := &http.Server{Addr: config.Listen, Handler: a}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("whooktown-agent: %v", err)
+			stop()
+		}
+	}()
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				if err := a.reload(); err != nil {
+					log.Printf("whooktown-agent: reload failed, keeping the running configuration: %v", err)
+					continue
+				}
+				log.Printf("whooktown-agent: configuration reloaded")
+			}
+		}
+	}()
+
+	log.Printf("whooktown-agent: %d collectors, listening on %s", len(config.Collectors), config.Listen)
+	a.scheduler.Run(ctx)
+
+	shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	server.Shutdown(shutdown)
+}
+
+// built is a configuration turned into collectors
+type built struct {
+	names      *whooktown.Registry
+	collectors map[string]whooktown.Collector
+	keys       map[string]string
+	types      map[string]string
+	sensors    map[uuid.UUID]bool // Sensors fed by the collectors
+}
+
+// build creates the collectors of a configuration
+func build(config *Config) (*built, error) {
+	names, err := config.registry()
+	if err != nil {
+		return nil, err
+	}
+	b := &built{
+		names:      names,
+		collectors: make(map[string]whooktown.Collector),
+		keys:       make(map[string]string),
+		types:      make(map[string]string),
+		sensors:    make(map[uuid.UUID]bool),
+	}
+	for i := range config.Collectors {
+		spec := &config.Collectors[i]
+		sensorID := spec.sensorID(names)
+		c, sensors, err := newCollector(spec, sensorID, names)
+		if err != nil {
+			return nil, err
+		}
+		key, err := spec.key(sensorID, config)
+		if err != nil {
+			return nil, err
+		}
+		b.collectors[spec.Name] = c
+		b.keys[spec.Name] = key
+		b.types[spec.Name] = spec.Type
+		for _, id := range sensors {
+			b.sensors[id] = true
+		}
+	}
+	return b, nil
+}
+
+// sent is the last update sent to a sensor
+type sent struct {
+	Name   string                `json:"name,omitempty"`
+	Data   *whooktown.SensorData `json:"data"`
+	SentAt time.Time             `json:"sent_at"`
+}
+
+// agent owns the running configuration
+type agent struct {
+	path      string
+	registry  *whooktown.CollectorRegistry
+	scheduler *whooktown.Scheduler
+	started   time.Time
+
+	mu        sync.RWMutex
+	client    *whooktown.Client
+	clientKey string
+	names     *whooktown.Registry
+	keys      map[string]string
+	types     map[string]string
+	loadedAt  time.Time
+	reloadErr error
+	last      map[uuid.UUID]sent
+}
+
+// newAgent creates an agent reading its configuration from path
+func newAgent(path string) *agent {
+	a := &agent{
+		path:     path,
+		registry: whooktown.NewCollectorRegistry(),
+		started:  time.Now(),
+		keys:     make(map[string]string),
+		types:    make(map[string]string),
+		last:     make(map[uuid.UUID]sent),
+	}
+	a.scheduler = whooktown.NewScheduler(a, a.registry, whooktown.SchedulerConfig{
+		OnError: func(name string, err error) {
+			log.Printf("whooktown-agent: %s: %v", name, err)
+		},
+	})
+	return a
+}
+
+// Send forwards an update to the current client
+func (a *agent) Send(ctx context.Context, data *whooktown.SensorData) error {
+	a.mu.RLock()
+	client := a.client
+	a.mu.RUnlock()
+	return client.Sensors.Send(ctx, data)
+}
+
+// reload reads the configuration file again and applies it
+func (a *agent) reload() error {
+	config, err := loadConfig(a.path)
+	if err == nil {
+		err = a.apply(config)
+	}
+	a.mu.Lock()
+	a.reloadErr = err
+	a.mu.Unlock()
+	return err
+}
+
+// apply switches to a configuration. Nothing changes if it is invalid.
+func (a *agent) apply(config *Config) error {
+	b, err := build(config)
+	if err != nil {
+		return err
+	}
+
+	// A new client is only needed when the credentials or the policy change
+	token, err := config.token()
+	if err != nil {
+		return err
+	}
+	policy, _ := json.Marshal(config.Policy)
+	clientKey := fmt.Sprintf("%s\x00%s\x00%s\x00%s", token, config.Environment, config.SensorURL, policy)
+	a.mu.RLock()
+	client := a.client
+	sameClient := client != nil && clientKey == a.clientKey
+	a.mu.RUnlock()
+	if !sameClient {
+		opts := []whooktown.Option{
+			whooktown.WithToken(token),
+			whooktown.WithEnvironment(config.Environment),
+		}
+		if config.SensorURL != "" {
+			opts = append(opts, whooktown.WithSensorURL(config.SensorURL))
+		}
+		if config.Policy != nil {
+			opts = append(opts, whooktown.WithStatusPolicy(config.Policy))
+		}
+		if client, err = whooktown.New(opts...); err != nil {
+			return err
+		}
+		client.Sensors.AddHook(a.record)
+	}
+
+	// Everything that can fail is done: switch to the new configuration
+	a.mu.Lock()
+	a.client = client
+	a.clientKey = clientKey
+	a.names = b.names
+	oldKeys := a.keys
+	a.keys = b.keys
+	a.types = b.types
+	a.loadedAt = time.Now()
+	for id := range a.last {
+		if !b.sensors[id] {
+			delete(a.last, id)
+		}
+	}
+	a.mu.Unlock()
+
+	for name := range oldKeys {
+		if _, ok := b.keys[name]; !ok {
+			a.registry.Unregister(name)
+		}
+	}
+	for name, c := range b.collectors {
+		if oldKeys[name] != b.keys[name] {
+			// Replace only rejects an empty name, which loadConfig rejects first
+			a.registry.Replace(c)
+		}
+	}
+	return nil
+}
+
+// record keeps the last update sent to each sensor
+func (a *agent) record(data *whooktown.SensorData, err error) {
+	if err != nil {
+		return
+	}
+	d := data.Clone()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	name, _ := a.names.Name(d.ID)
+	a.last[d.ID] = sent{Name: name, Data: d, SentAt: time.Now()}
+}
+
+// collectorHealth is the status of a collector in the health report
+type collectorHealth struct {
+	Name     string     `json:"name"`
+	Type     string     `json:"type"`
+	LastRun  *time.Time `json:"last_run,omitempty"`
+	Duration string     `json:"duration,omitempty"`
+	Sent     int        `json:"sent"`
+	Error    string     `json:"error,omitempty"`
+	Runs     int        `json:"runs"`
+	Failures int        `json:"failures"`
+}
+
+// health is the health report
+type health struct {
+	Status      string            `json:"status"`
+	StartedAt   time.Time         `json:"started_at"`
+	Config      string            `json:"config"`
+	LoadedAt    time.Time         `json:"loaded_at"`
+	ReloadError string            `json:"reload_error,omitempty"`
+	Collectors  []collectorHealth `json:"collectors"`
+}
+
+// ServeHTTP serves GET /health and GET /state
+func (a *agent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	switch r.URL.Path {
+	case "/health":
+		report, code := a.health()
+		writeJSON(w, code, report)
+	case "/state":
+		writeJSON(w, http.StatusOK, a.state())
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// health builds the health report. The agent is degraded when a collector
+// failed its last run and unhealthy when all of them did.
+func (a *agent) health() (health, int) {
+	a.mu.RLock()
+	report := health{
+		Status:    "ok",
+		StartedAt: a.started,
+		Config:    a.path,
+		LoadedAt:  a.loadedAt,
+	}
+	if a.reloadErr != nil {
+		report.ReloadError = a.reloadErr.Error()
+	}
+	types := a.types
+	a.mu.RUnlock()
+
+	status := make(map[string]whooktown.CollectorStatus)
+	for _, st := range a.scheduler.Status() {
+		status[st.Name] = st
+	}
+	failing := 0
+	report.Collectors = make([]collectorHealth, 0, len(types))
+	for name, typ := range types {
+		h := collectorHealth{Name: name, Type: typ}
+		if st, ok := status[name]; ok {
+			h.LastRun = &st.LastRun
+			h.Duration = st.Duration.String()
+			h.Sent = st.Sent
+			h.Runs = st.Runs
+			h.Failures = st.Failures
+			if st.Err != nil {
+				h.Error = st.Err.Error()
+				failing++
+			}
+		}
+		report.Collectors = append(report.Collectors, h)
+	}
+	sort.Slice(report.Collectors, func(i, j int) bool {
+		return report.Collectors[i].Name < report.Collectors[j].Name
+	})
+
+	code := http.StatusOK
+	switch {
+	case failing > 0 && failing == len(types):
+		report.Status = "failing"
+		code = http.StatusServiceUnavailable
+	case failing > 0 || report.ReloadError != "":
+		report.Status = "degraded"
+	}
+	return report, code
+}
+
+// state returns the last update sent to each sensor, keyed by sensor ID
+func (a *agent) state() map[string]sent {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	state := make(map[string]sent, len(a.last))
+	for id, s := range a.last {
+		state[id.String()] = s
+	}
+	return state
+}
+
+// writeJSON writes an indented JSON response
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
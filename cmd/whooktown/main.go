@@ -0,0 +1,172 @@
+// Command whooktown wraps cron and batch jobs to report them on a whooktown building.
+//
+//	whooktown run --sensor <id> [--name backup] [--timeout 1h] [--state file] -- <cmd> [args...]
+//	whooktown check --sensor <id> --every 24h [--grace 1h] --state file
+//
+// The token is read from WHOOKTOWN_TOKEN; set WHOOKTOWN_ENV=DEV for development.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	whooktown "github.com/fredericalix/whooktown-golang-sdk"
+	"github.com/fredericalix/whooktown-golang-sdk/job"
+	"github.com/gofrs/uuid"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var code int
+	switch os.Args[1] {
+	case "run":
+		code = runCommand(ctx, os.Args[2:])
+	case "check":
+		code = checkCommand(ctx, os.Args[2:])
+	case "-h", "--help", "help":
+		usage()
+	default:
+		fmt.Fprintf(os.Stderr, "whooktown: unknown command %q\n", os.Args[1])
+		usage()
+		code = 2
+	}
+	stop()
+	os.Exit(code)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `usage:
+  whooktown run --sensor <id> [--name name] [--timeout d] [--state file] -- <cmd> [args...]
+  whooktown check --sensor <id> --every d [--grace d] --state file`)
+}
+
+// runCommand runs a job and exits with its exit code
+func runCommand(ctx context.Context, args []string) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	sensor := flags.String("sensor", "", "sensor ID of the building")
+	name := flags.String("name", "", "job name shown on the building (default: command name)")
+	timeout := flags.Duration("timeout", 0, "kill the job after this duration")
+	state := flags.String("state", "", "file recording the last completed run, for check")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "whooktown run: command is required")
+		return 2
+	}
+
+	client, sensorID, err := setup(*sensor)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "whooktown run: %v\n", err)
+		return 2
+	}
+
+	j, err := job.New(client.Sensors, job.Config{
+		SensorID:  sensorID,
+		Name:      *name,
+		Command:   flags.Args(),
+		Timeout:   *timeout,
+		Stdout:    os.Stdout,
+		Stderr:    os.Stderr,
+		StateFile: *state,
+		OnError: func(err error) {
+			fmt.Fprintf(os.Stderr, "whooktown run: %v\n", err)
+		},
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "whooktown run: %v\n", err)
+		return 2
+	}
+
+	result := j.Run(ctx)
+	switch {
+	case result.ExitCode > 0:
+		return result.ExitCode
+	case result.Err != nil:
+		fmt.Fprintf(os.Stderr, "whooktown run: %v\n", result.Err)
+		return 1
+	}
+	return 0
+}
+
+// checkCommand warns the building when the last recorded run is late.
+// It exits with 1 when the job is late.
+func checkCommand(ctx context.Context, args []string) int {
+	flags := flag.NewFlagSet("check", flag.ContinueOnError)
+	sensor := flags.String("sensor", "", "sensor ID of the building")
+	every := flags.Duration("every", 0, "expected time between runs")
+	grace := flags.Duration("grace", 0, "delay tolerated after --every (default: every/10)")
+	state := flags.String("state", "", "state file written by run --state")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *state == "" {
+		fmt.Fprintln(os.Stderr, "whooktown check: --state is required")
+		return 2
+	}
+
+	client, sensorID, err := setup(*sensor)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "whooktown check: %v\n", err)
+		return 2
+	}
+
+	// Each invocation is a fresh process: a job that never ran is late
+	monitor, err := job.NewMonitor(client.Sensors, job.MonitorConfig{
+		SensorID:  sensorID,
+		Every:     *every,
+		Grace:     *grace,
+		StateFile: *state,
+		Since:     time.Unix(0, 0),
+		OnError: func(err error) {
+			fmt.Fprintf(os.Stderr, "whooktown check: %v\n", err)
+		},
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "whooktown check: %v\n", err)
+		return 2
+	}
+
+	if monitor.Check(ctx) {
+		if last, ok := monitor.LastRun(); ok {
+			fmt.Fprintf(os.Stderr, "whooktown check: late, last run %s\n", last.Format(time.RFC3339))
+		} else {
+			fmt.Fprintf(os.Stderr, "whooktown check: late, no run recorded in %s\n", *state)
+		}
+		return 1
+	}
+	return 0
+}
+
+// setup creates the client from the environment and parses the sensor ID
+func setup(sensor string) (*whooktown.Client, uuid.UUID, error) {
+	if sensor == "" {
+		return nil, uuid.Nil, errors.New("--sensor is required")
+	}
+	sensorID, err := uuid.FromString(sensor)
+	if err != nil {
+		return nil, uuid.Nil, fmt.Errorf("invalid sensor ID: %w", err)
+	}
+	token := os.Getenv("WHOOKTOWN_TOKEN")
+	if token == "" {
+		return nil, uuid.Nil, errors.New("WHOOKTOWN_TOKEN environment variable is required")
+	}
+	client, err := whooktown.New(whooktown.WithToken(token))
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+	return client, sensorID, nil
+}
@@ -0,0 +1,391 @@
+package whooktown
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Collector produces sensor updates on demand. Integrations implement it to
+// run under a Scheduler instead of their own loop.
+type Collector interface {
+	// Info describes the collector and its schedule
+	Info() CollectorInfo
+
+	// Collect gathers the current sensor updates
+	Collect(ctx context.Context) ([]SensorData, error)
+}
+
+// CollectorInfo is the metadata of a collector
+type CollectorInfo struct {
+	// Name identifies the collector in a registry
+	Name string
+
+	// Description is free text for status pages
+	Description string
+
+	// Interval between runs (default: SchedulerConfig.Interval)
+	Interval time.Duration
+
+	// Timeout bounds a collection; sending the updates is bounded by
+	// SchedulerConfig.SendTimeout (default: SchedulerConfig.Timeout)
+	Timeout time.Duration
+}
+
+// collectorFunc adapts a function to the Collector interface
+type collectorFunc struct {
+	info    CollectorInfo
+	collect func(ctx context.Context) ([]SensorData, error)
+}
+
+func (c *collectorFunc) Info() CollectorInfo { return c.info }
+
+func (c *collectorFunc) Collect(ctx context.Context) ([]SensorData, error) {
+	return c.collect(ctx)
+}
+
+// NewCollector creates a collector from metadata and a collect function.
+// The Collect methods of integrations such as hostmetrics.Collector,
+// prometheus.Scraper and kpi.Poller fit directly, e.g.
+// NewCollector(CollectorInfo{Name: "api"}, scraper.Collect).
+func NewCollector(info CollectorInfo, collect func(ctx context.Context) ([]SensorData, error)) Collector {
+	return &collectorFunc{info: info, collect: collect}
+}
+
+// CollectorRegistry holds collectors by name
+type CollectorRegistry struct {
+	mu         sync.RWMutex
+	collectors map[string]registered
+	seq        uint64
+	changed    chan struct{}
+}
+
+// registered is a collector and the registration it came from, so that a
+// scheduler can tell a replaced collector from the one it is running
+type registered struct {
+	collector Collector
+	seq       uint64
+}
+
+// NewCollectorRegistry creates an empty registry
+func NewCollectorRegistry() *CollectorRegistry {
+	return &CollectorRegistry{
+		collectors: make(map[string]registered),
+		changed:    make(chan struct{}, 1),
+	}
+}
+
+// Register adds a collector. It fails if the name is empty or taken.
+func (r *CollectorRegistry) Register(c Collector) error {
+	return r.add(c, false)
+}
+
+// Replace adds a collector, replacing any collector of the same name.
+// A running scheduler restarts the collector and keeps its status.
+func (r *CollectorRegistry) Replace(c Collector) error {
+	return r.add(c, true)
+}
+
+// add registers a collector, replacing an existing one when allowed
+func (r *CollectorRegistry) add(c Collector, replace bool) error {
+	name := c.Info().Name
+	if name == "" {
+		return NewError(ErrValidation, "collector name is required")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.collectors[name]; ok && !replace {
+		return NewError(ErrValidation, fmt.Sprintf("collector %s is already registered", name))
+	}
+	r.seq++
+	r.collectors[name] = registered{collector: c, seq: r.seq}
+	r.notify()
+	return nil
+}
+
+// Unregister removes a collector by name
+func (r *CollectorRegistry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.collectors[name]; ok {
+		delete(r.collectors, name)
+		r.notify()
+	}
+}
+
+// Get returns a collector by name
+func (r *CollectorRegistry) Get(name string) (Collector, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	reg, ok := r.collectors[name]
+	return reg.collector, ok
+}
+
+// List returns the registered collectors, sorted by name
+func (r *CollectorRegistry) List() []Collector {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	list := make([]Collector, 0, len(r.collectors))
+	for _, reg := range r.collectors {
+		list = append(list, reg.collector)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Info().Name < list[j].Info().Name
+	})
+	return list
+}
+
+// snapshot returns a copy of the registrations by name
+func (r *CollectorRegistry) snapshot() map[string]registered {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	snap := make(map[string]registered, len(r.collectors))
+	for name, reg := range r.collectors {
+		snap[name] = reg
+	}
+	return snap
+}
+
+// notify signals a change to the scheduler. Callers hold r.mu.
+func (r *CollectorRegistry) notify() {
+	select {
+	case r.changed <- struct{}{}:
+	default:
+	}
+}
+
+// SchedulerConfig configures a collector scheduler
+type SchedulerConfig struct {
+	// Interval is the default run interval (default: 30s)
+	Interval time.Duration
+
+	// Timeout is the default collection timeout (default: 10s)
+	Timeout time.Duration
+
+	// SendTimeout bounds each update sent (default: 10s)
+	SendTimeout time.Duration
+
+	// Jitter randomizes each interval by up to this fraction, e.g. 0.1 for ±10% (default: 0.1)
+	Jitter float64
+
+	// OnError is called when a collector fails, panics or its updates fail to send
+	OnError func(name string, err error)
+}
+
+// CollectorStatus is the outcome of the last run of a collector
+type CollectorStatus struct {
+	Name     string
+	LastRun  time.Time
+	Duration time.Duration
+	Sent     int   // Updates sent by the last run
+	Err      error // Last run error, including send errors
+	Runs     int
+	Failures int
+}
+
+// Scheduler runs the collectors of a registry at their intervals and sends
+// their updates. A failing or panicking collector does not affect the others.
+type Scheduler struct {
+	sensors  SensorSender
+	registry *CollectorRegistry
+	config   SchedulerConfig
+
+	mu     sync.Mutex
+	status map[string]*CollectorStatus
+}
+
+// NewScheduler creates a scheduler sending the updates of registry collectors to sensors
+func NewScheduler(sensors SensorSender, registry *CollectorRegistry, config SchedulerConfig) *Scheduler {
+	if config.Interval <= 0 {
+		config.Interval = 30 * time.Second
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	if config.SendTimeout <= 0 {
+		config.SendTimeout = 10 * time.Second
+	}
+	if config.Jitter == 0 {
+		config.Jitter = 0.1
+	}
+	config.Jitter = max(0, min(1, config.Jitter))
+	return &Scheduler{
+		sensors:  sensors,
+		registry: registry,
+		config:   config,
+		status:   make(map[string]*CollectorStatus),
+	}
+}
+
+// Run schedules the registered collectors until the context is cancelled.
+// Collectors registered, replaced or unregistered while running are picked
+// up; a registry feeds a single running scheduler.
+func (s *Scheduler) Run(ctx context.Context) error {
+	type runningCollector struct {
+		seq    uint64
+		cancel context.CancelFunc
+	}
+
+	var wg sync.WaitGroup
+	running := make(map[string]runningCollector)
+	defer func() {
+		for _, r := range running {
+			r.cancel()
+		}
+		wg.Wait()
+	}()
+
+	for {
+		current := s.registry.snapshot()
+		for name, r := range running {
+			reg, ok := current[name]
+			if ok && reg.seq == r.seq {
+				continue
+			}
+			r.cancel()
+			delete(running, name)
+			if !ok {
+				s.mu.Lock()
+				delete(s.status, name)
+				s.mu.Unlock()
+			}
+		}
+		for name, reg := range current {
+			if _, ok := running[name]; ok {
+				continue
+			}
+			cctx, cancel := context.WithCancel(ctx)
+			running[name] = runningCollector{seq: reg.seq, cancel: cancel}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.loop(cctx, reg.collector)
+			}()
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.registry.changed:
+		}
+	}
+}
+
+// RunOnce runs a collector immediately and sends its updates.
+// Runs whose context is cancelled are not recorded in Status.
+func (s *Scheduler) RunOnce(ctx context.Context, c Collector) CollectorStatus {
+	info := c.Info()
+	timeout := info.Timeout
+	if timeout <= 0 {
+		timeout = s.config.Timeout
+	}
+	start := time.Now()
+	collectCtx, cancel := context.WithTimeout(ctx, timeout)
+	updates, err := s.collect(collectCtx, c)
+	cancel()
+
+	// A collection that used up its timeout still gets to send its updates
+	sent := 0
+	var sendErrs []error
+	for i := range updates {
+		if err := s.send(ctx, &updates[i]); err != nil {
+			sendErrs = append(sendErrs, err)
+			continue
+		}
+		sent++
+	}
+	if len(sendErrs) > 0 {
+		err = errors.Join(append([]error{err}, sendErrs...)...)
+	}
+
+	s.mu.Lock()
+	// Run cancels the loop of an unregistered collector before deleting its
+	// status under s.mu, so a run still in flight must not write it back
+	if ctx.Err() != nil {
+		s.mu.Unlock()
+		return CollectorStatus{Name: info.Name, LastRun: start, Duration: time.Since(start), Sent: sent, Err: err}
+	}
+	st, ok := s.status[info.Name]
+	if !ok {
+		st = &CollectorStatus{Name: info.Name}
+		s.status[info.Name] = st
+	}
+	st.LastRun = start
+	st.Duration = time.Since(start)
+	st.Sent = sent
+	st.Err = err
+	st.Runs++
+	if err != nil {
+		st.Failures++
+	}
+	result := *st
+	s.mu.Unlock()
+
+	if err != nil && s.config.OnError != nil {
+		s.config.OnError(info.Name, err)
+	}
+	return result
+}
+
+// Status returns the last run status of every collector, sorted by name
+func (s *Scheduler) Status() []CollectorStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]CollectorStatus, 0, len(s.status))
+	for _, st := range s.status {
+		list = append(list, *st)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// loop runs a collector at its interval until the context is cancelled.
+// The first run is delayed by a random fraction of the interval to spread load.
+func (s *Scheduler) loop(ctx context.Context, c Collector) {
+	interval := c.Info().Interval
+	if interval <= 0 {
+		interval = s.config.Interval
+	}
+
+	timer := time.NewTimer(time.Duration(rand.Float64() * s.config.Jitter * float64(interval)))
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		s.RunOnce(ctx, c)
+		timer.Reset(s.jitter(interval))
+	}
+}
+
+// jitter randomizes an interval by up to ±Jitter
+func (s *Scheduler) jitter(d time.Duration) time.Duration {
+	f := 1 + s.config.Jitter*(2*rand.Float64()-1)
+	return time.Duration(float64(d) * f)
+}
+
+// send sends an update within SendTimeout
+func (s *Scheduler) send(ctx context.Context, data *SensorData) error {
+	ctx, cancel := context.WithTimeout(ctx, s.config.SendTimeout)
+	defer cancel()
+	return s.sensors.Send(ctx, data)
+}
+
+// collect calls a collector, turning panics into errors
+func (s *Scheduler) collect(ctx context.Context, c Collector) (updates []SensorData, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			updates = nil
+			err = NewError(ErrInternalServer, fmt.Sprintf("collector %s panicked: %v", c.Info().Name, r))
+		}
+	}()
+	return c.Collect(ctx)
+}
@@ -18,6 +18,8 @@ const (
 	ErrNetworkError   ErrorCode = "network_error"
 	ErrValidation     ErrorCode = "validation_error"
 	ErrTimeout        ErrorCode = "timeout"
+	ErrIO             ErrorCode = "io_error"   // Local file or process failure, not an API response
+	ErrOverloaded     ErrorCode = "overloaded" // A local queue or send limit is full, not an API quota
 )
 
 // Error is the SDK error type
@@ -30,9 +30,27 @@ func main() {
 		log.Fatalf("Invalid sensor ID: %v", err)
 	}
 
+	// Derive status and activity from metrics instead of setting them by hand
+	policy, err := whooktown.ParseStatusPolicy([]byte(`{
+		"thresholds": [
+			{"metric": "cpuUsage", "warning": 70, "critical": 90},
+			{"metric": "ramUsage", "warning": 70, "critical": 90},
+			{"metric": "temperature", "warning": 50, "critical": 60}
+		],
+		"activity": [
+			{"metric": "cpuUsage", "slow": 30, "fast": 101},
+			{"metric": "ramUsage", "slow": 30, "fast": 101}
+		],
+		"alert_activity": "fast"
+	}`))
+	if err != nil {
+		log.Fatalf("Invalid status policy: %v", err)
+	}
+
 	// Create client (uses PROD by default, set WHOOKTOWN_ENV=DEV for development)
 	client, err := whooktown.New(
 		whooktown.WithToken(token),
+		whooktown.WithStatusPolicy(policy),
 	)
 	if err != nil {
 		log.Fatalf("Failed to create client: %v", err)
@@ -49,29 +67,15 @@ func main() {
 		ramUsage := rand.Intn(100)
 		temp := 30 + rand.Intn(40)
 
-		// Determine status based on metrics
-		status := whooktown.StatusOnline
-		activity := whooktown.ActivityNormal
-
-		if cpuUsage > 90 || ramUsage > 90 || temp > 60 {
-			status = whooktown.StatusCritical
-			activity = whooktown.ActivityFast
-		} else if cpuUsage > 70 || ramUsage > 70 || temp > 50 {
-			status = whooktown.StatusWarning
-			activity = whooktown.ActivityFast
-		} else if cpuUsage < 30 && ramUsage < 30 {
-			activity = whooktown.ActivitySlow
-		}
-
-		// Send sensor data
-		err := client.Sensors.Send(ctx, &whooktown.SensorData{
+		// Send sensor data; Status and Activity are filled in by the policy
+		data := &whooktown.SensorData{
 			ID:          sensorID,
-			Status:      status,
-			Activity:    activity,
 			CPUUsage:    cpuUsage,
 			RAMUsage:    ramUsage,
 			Temperature: temp,
-		})
+		}
+		err := client.Sensors.Send(ctx, data)
+		status, _ := policy.Evaluate(data.Metrics())
 
 		if err != nil {
 			if whooktown.IsUnauthorized(err) {
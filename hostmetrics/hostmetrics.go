@@ -0,0 +1,167 @@
+// Package hostmetrics collects Linux host metrics from /proc and sends them
+// to a whooktown DataCenter building.
+package hostmetrics
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	whooktown "github.com/fredericalix/whooktown-golang-sdk"
+	"github.com/gofrs/uuid"
+)
+
+// Config configures a host metrics collector
+type Config struct {
+	// SensorID is the DataCenter building receiving the metrics
+	SensorID uuid.UUID
+
+	// ProcRoot is the proc filesystem root (default: /proc).
+	// Point it at a directory of fixture files for testing.
+	ProcRoot string
+
+	// Interval between samples (default: 10s)
+	Interval time.Duration
+
+	// LinkSpeed is the link capacity in bits per second used to normalize
+	// NetworkTraffic to 0-100 (default: 1 Gbit/s)
+	LinkSpeed uint64
+
+	// Interfaces to account for network traffic (default: all but loopback)
+	Interfaces []string
+
+	// OnError is called when sampling or sending fails
+	OnError func(err error)
+}
+
+// Collector samples host metrics and sends them as SensorData
+type Collector struct {
+	sensors whooktown.SensorSender
+	config  Config
+
+	mu      sync.Mutex
+	prevCPU cpuTimes
+	prevNet uint64
+	prevAt  time.Time
+}
+
+// New creates a host metrics collector sending to sensors
+func New(sensors whooktown.SensorSender, config Config) *Collector {
+	if config.ProcRoot == "" {
+		config.ProcRoot = "/proc"
+	}
+	if config.Interval <= 0 {
+		config.Interval = 10 * time.Second
+	}
+	if config.LinkSpeed == 0 {
+		config.LinkSpeed = 1_000_000_000
+	}
+	return &Collector{
+		sensors: sensors,
+		config:  config,
+	}
+}
+
+// Sample reads /proc and returns the current metrics. CPU usage and network
+// traffic are computed since the previous sample; the first sample reports
+// CPU usage since boot and no network traffic.
+func (c *Collector) Sample() (*whooktown.SensorData, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	cpu, err := readCPU(c.config.ProcRoot)
+	if err != nil {
+		return nil, whooktown.NewErrorWithCause(whooktown.ErrIO, "failed to read cpu stats", err)
+	}
+	mem, err := readMemUsage(c.config.ProcRoot)
+	if err != nil {
+		return nil, whooktown.NewErrorWithCause(whooktown.ErrIO, "failed to read memory stats", err)
+	}
+	netBytes, err := readNetBytes(c.config.ProcRoot, c.config.Interfaces)
+	if err != nil {
+		return nil, whooktown.NewErrorWithCause(whooktown.ErrIO, "failed to read network stats", err)
+	}
+	conns, err := readEstablished(c.config.ProcRoot)
+	if err != nil {
+		return nil, whooktown.NewErrorWithCause(whooktown.ErrIO, "failed to read tcp connections", err)
+	}
+
+	data := &whooktown.SensorData{
+		ID:          c.config.SensorID,
+		RAMUsage:    percent(mem),
+		ActiveConns: conns,
+	}
+
+	// Counters can go backwards if the kernel resets them; skip the delta then
+	dIdle, dTotal := cpu.idle, cpu.total
+	if !c.prevAt.IsZero() && cpu.total >= c.prevCPU.total && cpu.idle >= c.prevCPU.idle {
+		dIdle -= c.prevCPU.idle
+		dTotal -= c.prevCPU.total
+	}
+	if dTotal > 0 {
+		data.CPUUsage = percent(float64(dTotal-min(dIdle, dTotal)) / float64(dTotal) * 100)
+	}
+
+	if !c.prevAt.IsZero() && netBytes >= c.prevNet {
+		elapsed := now.Sub(c.prevAt).Seconds()
+		if elapsed > 0 {
+			bitsPerSec := float64(netBytes-c.prevNet) * 8 / elapsed
+			data.NetworkTraffic = percent(bitsPerSec / float64(c.config.LinkSpeed) * 100)
+		}
+	}
+
+	c.prevCPU = cpu
+	c.prevNet = netBytes
+	c.prevAt = now
+	return data, nil
+}
+
+// Collect samples the metrics and returns them as a single update
+func (c *Collector) Collect(ctx context.Context) ([]whooktown.SensorData, error) {
+	data, err := c.Sample()
+	if err != nil {
+		return nil, err
+	}
+	return []whooktown.SensorData{*data}, nil
+}
+
+// Run samples and sends metrics every Interval until the context is cancelled
+func (c *Collector) Run(ctx context.Context) error {
+	ticker := time.NewTicker(c.config.Interval)
+	defer ticker.Stop()
+
+	// Prime the counters so the first send carries real deltas
+	if _, err := c.Sample(); err != nil {
+		c.reportError(err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			data, err := c.Sample()
+			if err != nil {
+				c.reportError(err)
+				continue
+			}
+			if err := c.sensors.Send(ctx, data); err != nil {
+				c.reportError(err)
+			}
+		}
+	}
+}
+
+// reportError forwards an error to the configured handler
+func (c *Collector) reportError(err error) {
+	if c.config.OnError != nil {
+		c.config.OnError(err)
+	}
+}
+
+// percent rounds and clamps a value to 0-100
+func percent(v float64) int {
+	return int(math.Round(math.Max(0, math.Min(100, v))))
+}
@@ -0,0 +1,177 @@
+package hostmetrics
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// cpuTimes holds aggregate CPU jiffies from /proc/stat
+type cpuTimes struct {
+	idle  uint64
+	total uint64
+}
+
+// readCPU reads the aggregate "cpu" line of /proc/stat
+func readCPU(procRoot string) (cpuTimes, error) {
+	f, err := os.Open(filepath.Join(procRoot, "stat"))
+	if err != nil {
+		return cpuTimes{}, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || fields[0] != "cpu" {
+			continue
+		}
+		var t cpuTimes
+		// user nice system idle iowait irq softirq steal; guest time is
+		// already included in user and nice
+		for i, field := range fields[1:] {
+			if i >= 8 {
+				break
+			}
+			v, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return cpuTimes{}, fmt.Errorf("parse stat: %w", err)
+			}
+			t.total += v
+			if i == 3 || i == 4 {
+				t.idle += v
+			}
+		}
+		return t, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return cpuTimes{}, err
+	}
+	return cpuTimes{}, fmt.Errorf("parse stat: no cpu line")
+}
+
+// readMemUsage returns the percentage of memory in use from /proc/meminfo
+func readMemUsage(procRoot string) (float64, error) {
+	f, err := os.Open(filepath.Join(procRoot, "meminfo"))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	values := make(map[string]uint64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, rest, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			continue
+		}
+		v, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		values[key] = v
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	total := values["MemTotal"]
+	if total == 0 {
+		return 0, fmt.Errorf("parse meminfo: no MemTotal")
+	}
+	available, ok := values["MemAvailable"]
+	if !ok {
+		// Kernels before 3.14 have no MemAvailable
+		available = values["MemFree"] + values["Buffers"] + values["Cached"]
+	}
+	if available > total {
+		available = total
+	}
+	return float64(total-available) / float64(total) * 100, nil
+}
+
+// readNetBytes returns the received plus transmitted bytes of the selected
+// interfaces from /proc/net/dev. With no interfaces, all but loopback are summed.
+func readNetBytes(procRoot string, interfaces []string) (uint64, error) {
+	f, err := os.Open(filepath.Join(procRoot, "net", "dev"))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	selected := make(map[string]bool)
+	for _, name := range interfaces {
+		selected[name] = true
+	}
+
+	var sum uint64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		name, rest, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		name = strings.TrimSpace(name)
+		if len(selected) > 0 {
+			if !selected[name] {
+				continue
+			}
+		} else if name == "lo" {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) < 9 {
+			continue
+		}
+		rx, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("parse net/dev: %w", err)
+		}
+		tx, err := strconv.ParseUint(fields[8], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("parse net/dev: %w", err)
+		}
+		sum += rx + tx
+	}
+	return sum, scanner.Err()
+}
+
+// tcpEstablished is the connection state code of ESTABLISHED sockets
+const tcpEstablished = "01"
+
+// readEstablished counts established TCP connections in /proc/net/tcp and
+// /proc/net/tcp6. A missing tcp6 table (IPv6 disabled) is ignored.
+func readEstablished(procRoot string) (int, error) {
+	count := 0
+	for _, name := range []string{"tcp", "tcp6"} {
+		f, err := os.Open(filepath.Join(procRoot, "net", name))
+		if err != nil {
+			if name == "tcp6" && os.IsNotExist(err) {
+				continue
+			}
+			return 0, err
+		}
+
+		scanner := bufio.NewScanner(f)
+		scanner.Scan() // header
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) > 3 && fields[3] == tcpEstablished {
+				count++
+			}
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return 0, err
+		}
+	}
+	return count, nil
+}
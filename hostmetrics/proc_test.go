@@ -0,0 +1,80 @@
+package hostmetrics
+
+import (
+	"testing"
+
+	whooktown "github.com/fredericalix/whooktown-golang-sdk"
+)
+
+func TestReadCPU(t *testing.T) {
+	cpu, err := readCPU("testdata/proc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cpu.total != 9390 || cpu.idle != 3722 {
+		t.Errorf("got total %d idle %d, want 9390 and 3722", cpu.total, cpu.idle)
+	}
+}
+
+func TestReadMemUsage(t *testing.T) {
+	for root, want := range map[string]float64{
+		"testdata/proc":     75,
+		"testdata/proc-old": 62.5, // no MemAvailable
+	} {
+		mem, err := readMemUsage(root)
+		if err != nil {
+			t.Fatalf("%s: %v", root, err)
+		}
+		if mem != want {
+			t.Errorf("%s: got %v%%, want %v%%", root, mem, want)
+		}
+	}
+}
+
+func TestReadNetBytes(t *testing.T) {
+	sum, err := readNetBytes("testdata/proc", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum != 1300000 {
+		t.Errorf("all interfaces: got %d, want 1300000 without loopback", sum)
+	}
+	sum, err = readNetBytes("testdata/proc", []string{"eth0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum != 1250000 {
+		t.Errorf("eth0: got %d, want 1250000", sum)
+	}
+}
+
+func TestReadEstablished(t *testing.T) {
+	for root, want := range map[string]int{
+		"testdata/proc":     3,
+		"testdata/proc-old": 2, // no tcp6
+	} {
+		n, err := readEstablished(root)
+		if err != nil {
+			t.Fatalf("%s: %v", root, err)
+		}
+		if n != want {
+			t.Errorf("%s: got %d, want %d", root, n, want)
+		}
+	}
+}
+
+func TestSample(t *testing.T) {
+	c := New(nil, Config{ProcRoot: "testdata/proc"})
+	data, err := c.Sample()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.CPUUsage != 60 || data.RAMUsage != 75 || data.ActiveConns != 3 || data.NetworkTraffic != 0 {
+		t.Errorf("got cpu %d ram %d conns %d net %d", data.CPUUsage, data.RAMUsage, data.ActiveConns, data.NetworkTraffic)
+	}
+
+	_, err = New(nil, Config{ProcRoot: "testdata/missing"}).Sample()
+	if code, _ := whooktown.GetErrorCode(err); code != whooktown.ErrIO {
+		t.Errorf("missing proc root: got %v, want %s", err, whooktown.ErrIO)
+	}
+}
@@ -0,0 +1,199 @@
+package whooktown
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// HysteresisThreshold derives a status from a metric with separate enter and exit bounds.
+// A status is entered when the value reaches its Enter bound and left only once
+// the value falls back past its Exit bound. A nil Exit bound defaults to Enter.
+type HysteresisThreshold struct {
+	Metric        string   `json:"metric"`
+	WarningEnter  *float64 `json:"warning_enter,omitempty"`
+	WarningExit   *float64 `json:"warning_exit,omitempty"`
+	CriticalEnter *float64 `json:"critical_enter,omitempty"`
+	CriticalExit  *float64 `json:"critical_exit,omitempty"`
+	Below         bool     `json:"below,omitempty"` // Lower values are worse
+	Zero          bool     `json:"zero,omitempty"`  // A built-in field left at zero is a reading, not missing
+}
+
+// HysteresisConfig configures flap damping of status transitions
+type HysteresisConfig struct {
+	// Samples is the number of consecutive samples a new status must be
+	// reported before it is applied (0 or 1 disables the check)
+	Samples int
+
+	// MinDwell is how long a new status must persist before it is applied
+	MinDwell time.Duration
+
+	// Escalate applies worse statuses immediately and only damps recoveries
+	Escalate bool
+
+	// Thresholds, if set, derive the status from metrics instead of
+	// using the Status already set on the data
+	Thresholds []HysteresisThreshold
+}
+
+// Hysteresis damps status flapping per sensor ID.
+// It implements SensorSender so it can be placed in front of Sensors.Send.
+type Hysteresis struct {
+	next   SensorSender
+	config HysteresisConfig
+
+	mu     sync.Mutex
+	states map[uuid.UUID]*hysteresisState
+}
+
+// hysteresisState tracks the damped status of one sensor
+type hysteresisState struct {
+	current   Status
+	candidate Status
+	count     int
+	since     time.Time
+	levels    map[string]Status
+}
+
+// NewHysteresis creates a hysteresis filter sending filtered data to next.
+// next may be nil when only Filter is used.
+func NewHysteresis(next SensorSender, config HysteresisConfig) *Hysteresis {
+	return &Hysteresis{
+		next:   next,
+		config: config,
+		states: make(map[uuid.UUID]*hysteresisState),
+	}
+}
+
+// Send filters the status of data and forwards it to the next sender
+func (h *Hysteresis) Send(ctx context.Context, data *SensorData) error {
+	if h.next == nil {
+		return NewError(ErrValidation, "hysteresis has no sender")
+	}
+	return h.next.Send(ctx, h.Filter(data))
+}
+
+// Filter records a sample and returns a copy of data carrying the damped status
+func (h *Hysteresis) Filter(data *SensorData) *SensorData {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	st, ok := h.states[data.ID]
+	if !ok {
+		st = &hysteresisState{levels: make(map[string]Status)}
+		h.states[data.ID] = st
+	}
+
+	out := *data
+	status := data.Status
+	if len(h.config.Thresholds) > 0 {
+		if derived := st.derive(h.config.Thresholds, data.Metrics()); derived != "" {
+			status = derived
+		}
+	}
+	if status == "" {
+		return &out
+	}
+
+	now := time.Now()
+	switch {
+	case st.current == "" || status == st.current:
+		st.current = status
+		st.candidate = ""
+		st.count = 0
+	case h.config.Escalate && statusSeverity(status) > statusSeverity(st.current):
+		st.current = status
+		st.candidate = ""
+		st.count = 0
+	default:
+		if status != st.candidate {
+			st.candidate = status
+			st.count = 0
+			st.since = now
+		}
+		st.count++
+		if st.count >= h.config.Samples && now.Sub(st.since) >= h.config.MinDwell {
+			st.current = status
+			st.candidate = ""
+			st.count = 0
+		}
+	}
+
+	out.Status = st.current
+	return &out
+}
+
+// Status returns the damped status currently held for a sensor
+func (h *Hysteresis) Status(id uuid.UUID) Status {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if st, ok := h.states[id]; ok {
+		return st.current
+	}
+	return ""
+}
+
+// Reset forgets the state of a sensor
+func (h *Hysteresis) Reset(id uuid.UUID) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.states, id)
+}
+
+// derive evaluates thresholds against metrics using the previous level of each threshold
+func (st *hysteresisState) derive(thresholds []HysteresisThreshold, metrics map[string]float64) Status {
+	var status Status
+	for _, t := range thresholds {
+		if t.Zero {
+			addZeroMetric(metrics, t.Metric)
+		}
+		v, ok := metrics[t.Metric]
+		if !ok {
+			continue
+		}
+		level := t.evaluate(v, st.levels[t.Metric])
+		st.levels[t.Metric] = level
+		status = WorstStatus(status, level)
+	}
+	return status
+}
+
+// evaluate returns the level for v given the previous level
+func (t *HysteresisThreshold) evaluate(v float64, prev Status) Status {
+	reached := func(bound *float64) bool {
+		if bound == nil {
+			return false
+		}
+		if t.Below {
+			return v <= *bound
+		}
+		return v >= *bound
+	}
+	// held reports whether v has not yet fallen back past the exit bound
+	held := func(exit, enter *float64) bool {
+		if exit == nil {
+			exit = enter
+		}
+		if exit == nil {
+			return false
+		}
+		if t.Below {
+			return v < *exit
+		}
+		return v > *exit
+	}
+
+	switch {
+	case reached(t.CriticalEnter):
+		return StatusCritical
+	case prev == StatusCritical && held(t.CriticalExit, t.CriticalEnter):
+		return StatusCritical
+	case reached(t.WarningEnter):
+		return StatusWarning
+	case statusSeverity(prev) >= statusSeverity(StatusWarning) && held(t.WarningExit, t.WarningEnter):
+		return StatusWarning
+	}
+	return StatusOnline
+}
@@ -0,0 +1,252 @@
+// Package job wraps cron and batch jobs: the building runs fast while the job
+// runs, reports its exit status afterwards and turns warning when a run is late.
+package job
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	whooktown "github.com/fredericalix/whooktown-golang-sdk"
+	"github.com/gofrs/uuid"
+)
+
+// Config configures a job
+type Config struct {
+	SensorID uuid.UUID
+
+	// Name is shown on the building (default: the command name)
+	Name string
+
+	// Command is the program and its arguments; ignored when Func is set
+	Command []string
+	Dir     string   // Working directory
+	Env     []string // Extra environment, "KEY=value"
+
+	// Func runs a Go function instead of a command
+	Func func(ctx context.Context) error
+
+	// Timeout kills the job after this duration (0 disables)
+	Timeout time.Duration
+
+	// Stdout and Stderr receive the command output (default: discarded)
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// StateFile records the time of the last completed run for a Monitor
+	StateFile string
+
+	// OnError is called when a sensor update or the state file fails
+	OnError func(err error)
+}
+
+// Result is the outcome of a job run
+type Result struct {
+	Name      string
+	Status    whooktown.Status
+	ExitCode  int // -1 when the command could not start, timed out or Func failed
+	Err       error
+	StartedAt time.Time
+	Duration  time.Duration
+}
+
+// Summary is the short result text, e.g. "OK 1m2s" or "FAIL(2) 3s"
+func (r *Result) Summary() string {
+	d := formatDuration(r.Duration)
+	switch {
+	case r.Status == whooktown.StatusOnline:
+		return fmt.Sprintf("OK %s", d)
+	case r.ExitCode > 0:
+		return fmt.Sprintf("FAIL(%d) %s", r.ExitCode, d)
+	}
+	return fmt.Sprintf("FAIL %s", d)
+}
+
+// Job runs a command or function and reports it on a building
+type Job struct {
+	sensors whooktown.SensorSender
+	config  Config
+}
+
+// New validates the configuration and creates a job sending to sensors
+func New(sensors whooktown.SensorSender, config Config) (*Job, error) {
+	if config.SensorID == uuid.Nil {
+		return nil, whooktown.NewError(whooktown.ErrValidation, "job sensor id is required")
+	}
+	if config.Func == nil && len(config.Command) == 0 {
+		return nil, whooktown.NewError(whooktown.ErrValidation, "job command or func is required")
+	}
+	if config.Name == "" && len(config.Command) > 0 {
+		config.Name = config.Command[0]
+		if i := strings.LastIndexByte(config.Name, '/'); i >= 0 {
+			config.Name = config.Name[i+1:]
+		}
+	}
+	if config.Stdout == nil {
+		config.Stdout = io.Discard
+	}
+	if config.Stderr == nil {
+		config.Stderr = io.Discard
+	}
+	return &Job{sensors: sensors, config: config}, nil
+}
+
+// Run executes the job, sending a fast activity update when it starts and its
+// status, duration and result when it ends
+func (j *Job) Run(ctx context.Context) Result {
+	result := Result{
+		Name:      j.config.Name,
+		StartedAt: time.Now(),
+	}
+
+	j.send(ctx, &whooktown.SensorData{
+		ID:        j.config.SensorID,
+		Activity:  whooktown.ActivityFast,
+		TowerText: "RUNNING",
+		Text1:     j.config.Name,
+		Text2:     "running",
+		Text3:     result.StartedAt.Format("15:04"),
+	})
+
+	runCtx := ctx
+	if j.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, j.config.Timeout)
+		defer cancel()
+	}
+
+	var err error
+	if j.config.Func != nil {
+		err = j.config.Func(runCtx)
+	} else {
+		err = j.command(runCtx).Run()
+	}
+	result.Duration = time.Since(result.StartedAt)
+
+	var exitErr *exec.ExitError
+	switch {
+	case errors.Is(runCtx.Err(), context.DeadlineExceeded):
+		result.ExitCode = -1
+		if ctx.Err() != nil {
+			// The caller's deadline expired, not Timeout
+			result.Err = fmt.Errorf("timed out after %s: %w", result.Duration.Round(time.Millisecond), ctx.Err())
+		} else {
+			result.Err = fmt.Errorf("timed out after %s", j.config.Timeout)
+		}
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitCode()
+		result.Err = err
+	case err != nil:
+		result.ExitCode = -1
+		result.Err = err
+	}
+	if result.Err == nil {
+		result.Status = whooktown.StatusOnline
+	} else {
+		result.Status = whooktown.StatusCritical
+	}
+
+	// Report the outcome even when the parent context was cancelled
+	sendCtx := ctx
+	if ctx.Err() != nil {
+		var cancel context.CancelFunc
+		sendCtx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+	}
+	j.send(sendCtx, j.sensorData(&result))
+
+	if j.config.StateFile != "" {
+		if err := writeState(j.config.StateFile, result.StartedAt.Add(result.Duration)); err != nil {
+			j.reportError(err)
+		}
+	}
+	return result
+}
+
+// command builds the command to execute
+func (j *Job) command(ctx context.Context) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, j.config.Command[0], j.config.Command[1:]...)
+	cmd.Dir = j.config.Dir
+	if len(j.config.Env) > 0 {
+		cmd.Env = append(cmd.Environ(), j.config.Env...)
+	}
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = j.config.Stdout
+	cmd.Stderr = j.config.Stderr
+	// Don't wait forever on children that keep the output open after a kill
+	cmd.WaitDelay = time.Second
+	return cmd
+}
+
+// sensorData maps a result to a sensor update
+func (j *Job) sensorData(r *Result) *whooktown.SensorData {
+	detail := "ok"
+	if r.Err != nil {
+		detail = r.Err.Error()
+	}
+	return &whooktown.SensorData{
+		ID:        j.config.SensorID,
+		Status:    r.Status,
+		Activity:  whooktown.ActivitySlow,
+		TowerText: r.Summary(),
+		Text1:     j.config.Name,
+		Text2:     detail,
+		Text3:     formatDuration(r.Duration),
+	}
+}
+
+// formatDuration rounds a duration for display
+func formatDuration(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
+
+// send forwards an update, reporting failures
+func (j *Job) send(ctx context.Context, data *whooktown.SensorData) {
+	if j.sensors == nil {
+		return
+	}
+	if err := j.sensors.Send(ctx, data); err != nil {
+		j.reportError(err)
+	}
+}
+
+// reportError forwards an error to the configured handler
+func (j *Job) reportError(err error) {
+	if j.config.OnError != nil {
+		j.config.OnError(err)
+	}
+}
+
+// writeState records the completion time of a run
+func writeState(path string, t time.Time) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.FormatInt(t.Unix(), 10)+"\n"), 0o644); err != nil {
+		return whooktown.NewErrorWithCause(whooktown.ErrIO, "failed to write job state", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return whooktown.NewErrorWithCause(whooktown.ErrIO, "failed to write job state", err)
+	}
+	return nil
+}
+
+// ReadState returns the time of the last completed run recorded in a state file
+func ReadState(path string) (time.Time, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	sec, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil {
+		return time.Time{}, whooktown.NewErrorWithCause(whooktown.ErrValidation, "invalid job state file", err)
+	}
+	return time.Unix(sec, 0), nil
+}
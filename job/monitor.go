@@ -0,0 +1,152 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"sync"
+	"time"
+
+	whooktown "github.com/fredericalix/whooktown-golang-sdk"
+	"github.com/gofrs/uuid"
+)
+
+// MonitorConfig configures a schedule monitor
+type MonitorConfig struct {
+	SensorID uuid.UUID
+
+	// Every is the expected time between runs
+	Every time.Duration
+
+	// Grace is the delay tolerated after Every (default: Every/10)
+	Grace time.Duration
+
+	// StateFile is read for the last run written by a Job in another process
+	StateFile string
+
+	// Since starts the schedule until a run is recorded (default: now)
+	Since time.Time
+
+	// Interval between checks in Run (default: 1m)
+	Interval time.Duration
+
+	// OnError is called when the state file or a sensor update fails
+	OnError func(err error)
+}
+
+// Monitor raises a warning on the building when a job did not run within its schedule
+type Monitor struct {
+	sensors whooktown.SensorSender
+	config  MonitorConfig
+
+	mu      sync.Mutex
+	lastRun time.Time
+	ran     bool
+	late    bool
+}
+
+// NewMonitor validates the configuration and creates a monitor sending to sensors
+func NewMonitor(sensors whooktown.SensorSender, config MonitorConfig) (*Monitor, error) {
+	if config.SensorID == uuid.Nil {
+		return nil, whooktown.NewError(whooktown.ErrValidation, "monitor sensor id is required")
+	}
+	if config.Every <= 0 {
+		return nil, whooktown.NewError(whooktown.ErrValidation, "monitor schedule is required")
+	}
+	if config.Grace <= 0 {
+		config.Grace = config.Every / 10
+	}
+	if config.Interval <= 0 {
+		config.Interval = time.Minute
+	}
+	if config.Since.IsZero() {
+		config.Since = time.Now()
+	}
+	return &Monitor{
+		sensors: sensors,
+		config:  config,
+		lastRun: config.Since,
+	}, nil
+}
+
+// Ran records a completed run
+func (m *Monitor) Ran(t time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.ran || t.After(m.lastRun) {
+		m.lastRun = t
+		m.ran = true
+		m.late = false
+	}
+}
+
+// LastRun returns the time of the last recorded run, if any
+func (m *Monitor) LastRun() (time.Time, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lastRun, m.ran
+}
+
+// Check reads the state file and sends a warning the first time the job is late.
+// It reports whether the job is late.
+func (m *Monitor) Check(ctx context.Context) bool {
+	if m.config.StateFile != "" {
+		t, err := ReadState(m.config.StateFile)
+		switch {
+		case err == nil:
+			m.Ran(t)
+		case !errors.Is(err, fs.ErrNotExist):
+			m.reportError(err)
+		}
+	}
+
+	m.mu.Lock()
+	overdue := time.Since(m.lastRun) > m.config.Every+m.config.Grace
+	notify := overdue && !m.late
+	m.late = overdue
+	detail := "never ran"
+	if m.ran {
+		detail = "late since " + m.lastRun.Add(m.config.Every).Format("Jan 2 15:04")
+	}
+	m.mu.Unlock()
+
+	if notify && m.sensors != nil {
+		err := m.sensors.Send(ctx, &whooktown.SensorData{
+			ID:        m.config.SensorID,
+			Status:    whooktown.StatusWarning,
+			TowerText: "LATE",
+			Text2:     detail,
+		})
+		if err != nil {
+			m.reportError(err)
+			// Retry on the next check
+			m.mu.Lock()
+			m.late = false
+			m.mu.Unlock()
+		}
+	}
+	return overdue
+}
+
+// Run checks the schedule every Interval until the context is cancelled
+func (m *Monitor) Run(ctx context.Context) error {
+	ticker := time.NewTicker(m.config.Interval)
+	defer ticker.Stop()
+
+	m.Check(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			m.Check(ctx)
+		}
+	}
+}
+
+// reportError forwards an error to the configured handler
+func (m *Monitor) reportError(err error) {
+	if m.config.OnError != nil {
+		m.config.OnError(err)
+	}
+}
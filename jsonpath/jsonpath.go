@@ -0,0 +1,218 @@
+// Package jsonpath extracts values from decoded JSON documents using a
+// small path expression syntax.
+//
+// A path is a sequence of segments, optionally starting with "$":
+//
+//	$.data.items[0].name   object keys and array indexes
+//	items[-1]              negative indexes count from the end
+//	labels["app.kubernetes.io/name"]  quoted keys may contain any character
+//	orders.#               the length of an array, object or string
+package jsonpath
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// segment is a single step of a path
+type segment struct {
+	key    string
+	index  int
+	isIdx  bool
+	length bool
+}
+
+// Path is a compiled path expression
+type Path struct {
+	expr     string
+	segments []segment
+}
+
+// Compile parses a path expression
+func Compile(expr string) (*Path, error) {
+	p := &Path{expr: expr}
+	s := strings.TrimSpace(expr)
+	s = strings.TrimPrefix(s, "$")
+
+	for len(s) > 0 {
+		switch s[0] {
+		case '.':
+			s = s[1:]
+			if s == "" {
+				return nil, fmt.Errorf("jsonpath %q: trailing dot", expr)
+			}
+		case '[':
+			end := closingBracket(s)
+			if end < 0 {
+				return nil, fmt.Errorf("jsonpath %q: unterminated bracket", expr)
+			}
+			inner := strings.TrimSpace(s[1:end])
+			s = s[end+1:]
+			if len(inner) >= 2 && (inner[0] == '"' || inner[0] == '\'') && inner[len(inner)-1] == inner[0] {
+				key := inner[1 : len(inner)-1]
+				if inner[0] == '"' {
+					unquoted, err := strconv.Unquote(inner)
+					if err != nil {
+						return nil, fmt.Errorf("jsonpath %q: invalid quoted key: %w", expr, err)
+					}
+					key = unquoted
+				}
+				p.segments = append(p.segments, segment{key: key})
+				continue
+			}
+			idx, err := strconv.Atoi(inner)
+			if err != nil {
+				return nil, fmt.Errorf("jsonpath %q: invalid index %q", expr, inner)
+			}
+			p.segments = append(p.segments, segment{index: idx, isIdx: true})
+			continue
+		}
+
+		end := strings.IndexAny(s, ".[")
+		if end < 0 {
+			end = len(s)
+		}
+		key := s[:end]
+		s = s[end:]
+		if key == "" {
+			return nil, fmt.Errorf("jsonpath %q: empty key", expr)
+		}
+		if key == "#" {
+			if s != "" {
+				return nil, fmt.Errorf("jsonpath %q: # must be the last segment", expr)
+			}
+			p.segments = append(p.segments, segment{length: true})
+			continue
+		}
+		p.segments = append(p.segments, segment{key: key})
+	}
+	return p, nil
+}
+
+// MustCompile is like Compile but panics on invalid expressions
+func MustCompile(expr string) *Path {
+	p, err := Compile(expr)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// String returns the source expression
+func (p *Path) String() string {
+	return p.expr
+}
+
+// Get returns the value at the path in a document decoded by encoding/json
+func (p *Path) Get(doc interface{}) (interface{}, bool) {
+	v := doc
+	for _, seg := range p.segments {
+		switch {
+		case seg.length:
+			switch t := v.(type) {
+			case []interface{}:
+				return float64(len(t)), true
+			case map[string]interface{}:
+				return float64(len(t)), true
+			case string:
+				return float64(len(t)), true
+			}
+			return nil, false
+		case seg.isIdx:
+			arr, ok := v.([]interface{})
+			if !ok {
+				return nil, false
+			}
+			i := seg.index
+			if i < 0 {
+				i += len(arr)
+			}
+			if i < 0 || i >= len(arr) {
+				return nil, false
+			}
+			v = arr[i]
+		default:
+			obj, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if v, ok = obj[seg.key]; !ok {
+				return nil, false
+			}
+		}
+	}
+	return v, true
+}
+
+// Get compiles expr and returns the value at that path in doc
+func Get(doc interface{}, expr string) (interface{}, bool, error) {
+	p, err := Compile(expr)
+	if err != nil {
+		return nil, false, err
+	}
+	v, ok := p.Get(doc)
+	return v, ok, nil
+}
+
+// Float converts an extracted value to a number. Numeric strings and
+// booleans are accepted.
+func Float(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		return f, err == nil
+	case bool:
+		if n {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// String converts an extracted scalar value to its text form
+func String(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case json.Number:
+		return t.String()
+	case bool:
+		return strconv.FormatBool(t)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// closingBracket returns the index of the bracket closing s[0], skipping quoted text
+func closingBracket(s string) int {
+	var quote byte
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0 && c == '\\':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == ']':
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,368 @@
+// Package kpi polls JSON HTTP endpoints for business indicators (revenue,
+// orders...) and shows them on Bank and Display buildings.
+package kpi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"time"
+
+	whooktown "github.com/fredericalix/whooktown-golang-sdk"
+	"github.com/fredericalix/whooktown-golang-sdk/jsonpath"
+	"github.com/gofrs/uuid"
+)
+
+// maxResponseSize bounds the size of a polled response
+const maxResponseSize = 8 << 20
+
+// Levels maps a value to a Bank quantity: below Low is none, below Medium is
+// low, below Full is medium, and full from there
+type Levels struct {
+	Low    float64 `json:"low"`
+	Medium float64 `json:"medium"`
+	Full   float64 `json:"full"`
+}
+
+// Quantity returns the quantity level of a value
+func (l *Levels) Quantity(v float64) string {
+	switch {
+	case v >= l.Full:
+		return whooktown.QuantityFull
+	case v >= l.Medium:
+		return whooktown.QuantityMedium
+	case v >= l.Low:
+		return whooktown.QuantityLow
+	}
+	return whooktown.QuantityNone
+}
+
+// Mapping extracts a value from the response into a sensor field
+type Mapping struct {
+	SensorID uuid.UUID `json:"sensor_id"`
+
+	// Sensor is a sensor name, used when SensorID is nil
+	Sensor string `json:"sensor,omitempty"`
+
+	// Field is the SensorData JSON field name, e.g. "amount", "quantity" or "text1"
+	Field string `json:"field"`
+
+	// Path is a jsonpath expression, e.g. "$.data.revenue"
+	Path string `json:"path"`
+
+	// Factor multiplies numeric values (e.g. 0.01 for cents)
+	Factor float64 `json:"factor,omitempty"`
+
+	// Levels maps numeric values to none/low/medium/full for the quantity field
+	Levels *Levels `json:"levels,omitempty"`
+
+	// Format is a fmt format for text fields, e.g. "%.0f orders"
+	Format string `json:"format,omitempty"`
+
+	path *jsonpath.Path
+}
+
+// Endpoint is a JSON HTTP endpoint and the mappings evaluated against it
+type Endpoint struct {
+	URL     string            `json:"url"`
+	Method  string            `json:"method,omitempty"` // Default: GET
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+
+	Mappings []Mapping `json:"mappings"`
+}
+
+// LoadEndpoints reads a JSON array of endpoints from a file
+func LoadEndpoints(path string) ([]Endpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, whooktown.NewErrorWithCause(whooktown.ErrValidation, "failed to read endpoints", err)
+	}
+	var endpoints []Endpoint
+	if err := json.Unmarshal(data, &endpoints); err != nil {
+		return nil, whooktown.NewErrorWithCause(whooktown.ErrValidation, "invalid endpoints", err)
+	}
+	return endpoints, nil
+}
+
+// Config configures a poller
+type Config struct {
+	Endpoints []Endpoint
+
+	// Interval between polls (default: 60s)
+	Interval time.Duration
+
+	// Timeout per request (default: 10s)
+	Timeout time.Duration
+
+	// HTTPClient performs requests (default: http.DefaultClient)
+	HTTPClient *http.Client
+
+	// Names resolves the Sensor names of mappings (default: a registry in
+	// whooktown.NamespaceWhooktown)
+	Names *whooktown.Registry
+
+	// OnError is called when a request, a mapping or a send fails
+	OnError func(err error)
+}
+
+// Poller periodically polls endpoints and publishes mapped values
+type Poller struct {
+	sensors whooktown.SensorSender
+	config  Config
+}
+
+// New validates the configuration and creates a poller sending to sensors
+func New(sensors whooktown.SensorSender, config Config) (*Poller, error) {
+	if config.Interval <= 0 {
+		config.Interval = 60 * time.Second
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+	if config.Names == nil {
+		config.Names = whooktown.NewRegistry(uuid.Nil)
+	}
+
+	endpoints := make([]Endpoint, len(config.Endpoints))
+	for i, e := range config.Endpoints {
+		if e.URL == "" {
+			return nil, whooktown.NewError(whooktown.ErrValidation, "endpoint url is required")
+		}
+		if e.Method == "" {
+			e.Method = http.MethodGet
+		}
+		e.Mappings = append([]Mapping(nil), e.Mappings...)
+		for j := range e.Mappings {
+			m := &e.Mappings[j]
+			if m.Field == "" || m.Path == "" {
+				return nil, whooktown.NewError(whooktown.ErrValidation, "mapping field and path are required")
+			}
+			if err := whooktown.ValidateField(m.Field); err != nil {
+				return nil, whooktown.NewErrorWithCause(whooktown.ErrValidation, fmt.Sprintf("mapping %s: invalid field", m.Path), err)
+			}
+			if m.Levels != nil && (m.Levels.Low > m.Levels.Medium || m.Levels.Medium > m.Levels.Full) {
+				return nil, whooktown.NewError(whooktown.ErrValidation, fmt.Sprintf("%s: levels must be ordered low <= medium <= full", m.Field))
+			}
+			if m.Field == "quantity" && m.Levels == nil {
+				return nil, whooktown.NewError(whooktown.ErrValidation, "quantity mappings require levels")
+			}
+			p, err := jsonpath.Compile(m.Path)
+			if err != nil {
+				return nil, whooktown.NewErrorWithCause(whooktown.ErrValidation, fmt.Sprintf("invalid path for %s", m.Field), err)
+			}
+			m.path = p
+			if m.SensorID == uuid.Nil && m.Sensor != "" {
+				m.SensorID = config.Names.ID(m.Sensor)
+			}
+		}
+		endpoints[i] = e
+	}
+	config.Endpoints = endpoints
+
+	return &Poller{
+		sensors: sensors,
+		config:  config,
+	}, nil
+}
+
+// Apply evaluates mappings against a decoded document and returns one update per sensor.
+// Paths that are missing or null are skipped. Invalid mappings and values
+// that cannot be set are skipped too and their errors joined.
+func Apply(mappings []Mapping, doc interface{}) ([]*whooktown.SensorData, error) {
+	var updates []*whooktown.SensorData
+	var errs []error
+	byID := make(map[uuid.UUID]*whooktown.SensorData)
+	for _, m := range mappings {
+		p := m.path
+		if p == nil {
+			var err error
+			if p, err = jsonpath.Compile(m.Path); err != nil {
+				errs = append(errs, whooktown.NewErrorWithCause(whooktown.ErrValidation, fmt.Sprintf("invalid path for %s", m.Field), err))
+				continue
+			}
+		}
+		raw, ok := p.Get(doc)
+		if !ok || raw == nil {
+			continue
+		}
+		value, err := m.value(raw)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		id := m.sensorID()
+		data, ok := byID[id]
+		if !ok {
+			data = &whooktown.SensorData{ID: id}
+			byID[id] = data
+			updates = append(updates, data)
+		}
+		if err := data.SetField(m.Field, value); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return updates, errors.Join(errs...)
+}
+
+// sensorID returns the sensor of the mapping, deriving it from Sensor in
+// whooktown.NamespaceWhooktown when SensorID is nil
+func (m *Mapping) sensorID() uuid.UUID {
+	if m.SensorID == uuid.Nil && m.Sensor != "" {
+		return whooktown.IDFromName(uuid.Nil, m.Sensor)
+	}
+	return m.SensorID
+}
+
+// value converts an extracted value for the mapped field
+func (m *Mapping) value(raw interface{}) (interface{}, error) {
+	if m.Factor == 0 && m.Levels == nil && m.Format == "" {
+		if n, ok := raw.(json.Number); ok {
+			f, _ := n.Float64()
+			return f, nil
+		}
+		return raw, nil
+	}
+
+	v, ok := jsonpath.Float(raw)
+	if !ok {
+		if m.Format != "" && m.Levels == nil && m.Factor == 0 {
+			return fmt.Sprintf(m.Format, jsonpath.String(raw)), nil
+		}
+		return nil, whooktown.NewError(whooktown.ErrValidation, fmt.Sprintf("%s: value at %s is not a number", m.Field, m.Path))
+	}
+	if m.Factor != 0 {
+		v *= m.Factor
+	}
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil, whooktown.NewError(whooktown.ErrValidation, fmt.Sprintf("%s: value at %s is not finite", m.Field, m.Path))
+	}
+	switch {
+	case m.Levels != nil:
+		return m.Levels.Quantity(v), nil
+	case m.Format != "":
+		return fmt.Sprintf(m.Format, v), nil
+	}
+	return v, nil
+}
+
+// Poll fetches every endpoint and returns the mapped sensor updates.
+// Failed endpoints are reported to OnError and skipped.
+func (p *Poller) Poll(ctx context.Context) []*whooktown.SensorData {
+	updates, err := p.Collect(ctx)
+	if err != nil {
+		p.reportError(err)
+	}
+	result := make([]*whooktown.SensorData, len(updates))
+	for i := range updates {
+		result[i] = &updates[i]
+	}
+	return result
+}
+
+// Collect fetches every endpoint and returns the mapped sensor updates.
+// Failed endpoints and mappings are skipped and their errors joined.
+func (p *Poller) Collect(ctx context.Context) ([]whooktown.SensorData, error) {
+	var updates []whooktown.SensorData
+	var errs []error
+	for _, e := range p.config.Endpoints {
+		doc, err := p.fetch(ctx, e)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		mapped, err := Apply(e.Mappings, doc)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		for _, data := range mapped {
+			updates = append(updates, *data)
+		}
+	}
+	return updates, errors.Join(errs...)
+}
+
+// RunOnce polls every endpoint and sends the updates
+func (p *Poller) RunOnce(ctx context.Context) {
+	for _, data := range p.Poll(ctx) {
+		if err := p.sensors.Send(ctx, data); err != nil {
+			p.reportError(err)
+		}
+	}
+}
+
+// Run polls every Interval until the context is cancelled
+func (p *Poller) Run(ctx context.Context) error {
+	ticker := time.NewTicker(p.config.Interval)
+	defer ticker.Stop()
+
+	p.RunOnce(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			p.RunOnce(ctx)
+		}
+	}
+}
+
+// fetch requests and decodes a single endpoint
+func (p *Poller) fetch(ctx context.Context, e Endpoint) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.config.Timeout)
+	defer cancel()
+
+	var body io.Reader
+	if e.Body != "" {
+		body = bytes.NewReader([]byte(e.Body))
+	}
+	req, err := http.NewRequestWithContext(ctx, e.Method, e.URL, body)
+	if err != nil {
+		return nil, whooktown.NewErrorWithCause(whooktown.ErrValidation, "invalid endpoint url", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if e.Body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range e.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := p.config.HTTPClient.Do(req)
+	if err != nil {
+		return nil, whooktown.NewErrorWithCause(whooktown.ErrNetworkError, "poll failed: "+e.URL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, &whooktown.Error{
+			Code:       whooktown.ErrNetworkError,
+			Message:    fmt.Sprintf("poll failed: %s returned %d", e.URL, resp.StatusCode),
+			StatusCode: resp.StatusCode,
+		}
+	}
+
+	var doc interface{}
+	dec := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, whooktown.NewErrorWithCause(whooktown.ErrValidation, "invalid json: "+e.URL, err)
+	}
+	return doc, nil
+}
+
+// reportError forwards an error to the configured handler
+func (p *Poller) reportError(err error) {
+	if p.config.OnError != nil {
+		p.config.OnError(err)
+	}
+}
@@ -0,0 +1,243 @@
+// Package logtail tails log files and animates a whooktown building from
+// their throughput and error rate.
+package logtail
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	whooktown "github.com/fredericalix/whooktown-golang-sdk"
+	"github.com/gofrs/uuid"
+)
+
+// Pattern counts lines matching a regular expression
+type Pattern struct {
+	Name   string `json:"name"`
+	Regexp string `json:"regexp"`
+	// Error patterns drive status instead of throughput
+	Error bool `json:"error,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// Config configures a detector
+type Config struct {
+	SensorID uuid.UUID
+
+	// Paths are the files to follow; rotated and truncated files are followed
+	Paths []string
+
+	// Patterns count matching lines. Throughput counts lines matching any
+	// non-error pattern, or every line when there are none.
+	Patterns []Pattern
+
+	// FromStart reads existing file content instead of starting at the end
+	FromStart bool
+
+	// Window is the counting window (default: 10s)
+	Window time.Duration
+
+	// PollInterval is how often files are checked for new lines (default: 500ms)
+	PollInterval time.Duration
+
+	// SlowBelow and FastAbove bound throughput in lines per second:
+	// below SlowBelow is slow, above FastAbove is fast
+	SlowBelow float64
+	FastAbove float64
+
+	// WarningRate and CriticalRate bound error lines per second (0 disables)
+	WarningRate  float64
+	CriticalRate float64
+
+	// OnError is called when reading a file or sending fails
+	OnError func(err error)
+}
+
+// Stats are the counts of a closed window
+type Stats struct {
+	Lines      int
+	Matches    map[string]int // Per pattern name
+	Throughput float64        // Lines per second counted as throughput
+	ErrorRate  float64        // Error lines per second
+	Status     whooktown.Status
+	Activity   whooktown.Activity
+}
+
+// Detector counts log lines per window and sends the derived status and activity
+type Detector struct {
+	sensors whooktown.SensorSender
+	config  Config
+
+	mu          sync.Mutex
+	lines       int
+	throughput  int
+	errors      int
+	matches     map[string]int
+	windowStart time.Time
+	last        Stats
+}
+
+// New validates the configuration and creates a detector sending to sensors
+func New(sensors whooktown.SensorSender, config Config) (*Detector, error) {
+	if config.Window <= 0 {
+		config.Window = 10 * time.Second
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = 500 * time.Millisecond
+	}
+	patterns := make([]Pattern, len(config.Patterns))
+	for i, p := range config.Patterns {
+		re, err := regexp.Compile(p.Regexp)
+		if err != nil {
+			return nil, whooktown.NewErrorWithCause(whooktown.ErrValidation, fmt.Sprintf("invalid pattern %s", p.Name), err)
+		}
+		p.re = re
+		patterns[i] = p
+	}
+	config.Patterns = patterns
+
+	return &Detector{
+		sensors:     sensors,
+		config:      config,
+		matches:     make(map[string]int),
+		windowStart: time.Now(),
+	}, nil
+}
+
+// Run follows the files and sends an update every Window until the context is cancelled
+func (d *Detector) Run(ctx context.Context) error {
+	followers := make([]*follower, len(d.config.Paths))
+	for i, path := range d.config.Paths {
+		f := &follower{path: path}
+		if err := f.open(d.config.FromStart); err != nil {
+			d.reportError(err)
+		}
+		followers[i] = f
+	}
+	defer func() {
+		for _, f := range followers {
+			f.close()
+		}
+	}()
+
+	poll := time.NewTicker(d.config.PollInterval)
+	defer poll.Stop()
+	window := time.NewTicker(d.config.Window)
+	defer window.Stop()
+
+	emit := func(line []byte) { d.Ingest(string(line)) }
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-poll.C:
+			for _, f := range followers {
+				if err := f.poll(emit); err != nil {
+					d.reportError(err)
+				}
+			}
+		case <-window.C:
+			d.Flush(ctx)
+		}
+	}
+}
+
+// Ingest counts a single line
+func (d *Detector) Ingest(line string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.lines++
+	counted := false
+	hasThroughput := false
+	for _, p := range d.config.Patterns {
+		if !p.Error {
+			hasThroughput = true
+		}
+		if !p.re.MatchString(line) {
+			continue
+		}
+		d.matches[p.Name]++
+		if p.Error {
+			d.errors++
+		} else {
+			counted = true
+		}
+	}
+	if counted || !hasThroughput {
+		d.throughput++
+	}
+}
+
+// Flush closes the current window and sends the derived update
+func (d *Detector) Flush(ctx context.Context) {
+	stats := d.closeWindow()
+	err := d.sensors.Send(ctx, &whooktown.SensorData{
+		ID:       d.config.SensorID,
+		Status:   stats.Status,
+		Activity: stats.Activity,
+	})
+	if err != nil {
+		d.reportError(err)
+	}
+}
+
+// Stats returns the counts of the last closed window
+func (d *Detector) Stats() Stats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.last
+}
+
+// closeWindow computes the window statistics and resets the counters
+func (d *Detector) closeWindow() Stats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	elapsed := now.Sub(d.windowStart).Seconds()
+	if elapsed <= 0 {
+		elapsed = d.config.Window.Seconds()
+	}
+	stats := Stats{
+		Lines:      d.lines,
+		Matches:    d.matches,
+		Throughput: float64(d.throughput) / elapsed,
+		ErrorRate:  float64(d.errors) / elapsed,
+	}
+
+	switch {
+	case d.config.CriticalRate > 0 && stats.ErrorRate >= d.config.CriticalRate:
+		stats.Status = whooktown.StatusCritical
+	case d.config.WarningRate > 0 && stats.ErrorRate >= d.config.WarningRate:
+		stats.Status = whooktown.StatusWarning
+	default:
+		stats.Status = whooktown.StatusOnline
+	}
+	switch {
+	case d.config.FastAbove > 0 && stats.Throughput > d.config.FastAbove:
+		stats.Activity = whooktown.ActivityFast
+	case stats.Throughput < d.config.SlowBelow || stats.Throughput == 0:
+		stats.Activity = whooktown.ActivitySlow
+	default:
+		stats.Activity = whooktown.ActivityNormal
+	}
+
+	d.lines = 0
+	d.throughput = 0
+	d.errors = 0
+	d.matches = make(map[string]int)
+	d.windowStart = now
+	d.last = stats
+	return stats
+}
+
+// reportError forwards an error to the configured handler
+func (d *Detector) reportError(err error) {
+	if d.config.OnError != nil {
+		d.config.OnError(err)
+	}
+}
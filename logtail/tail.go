@@ -0,0 +1,169 @@
+package logtail
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// maxLineSize bounds a buffered partial line; longer lines are split
+const maxLineSize = 64 * 1024
+
+// tailSize is how many bytes before the offset are kept to detect a file
+// truncated and rewritten in place
+const tailSize = 256
+
+// follower reads lines appended to a file, following rotation and truncation
+type follower struct {
+	path    string
+	file    *os.File
+	info    os.FileInfo
+	offset  int64
+	partial []byte
+	tail    []byte // last bytes read, ending at offset
+}
+
+// open opens the file, starting at its end unless fromStart is set.
+// A missing file is not an error; it is picked up once it appears.
+func (f *follower) open(fromStart bool) error {
+	file, err := os.Open(f.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.info = info
+	f.offset = 0
+	f.partial = f.partial[:0]
+	f.tail = f.tail[:0]
+	if fromStart {
+		return nil
+	}
+	if f.offset, err = file.Seek(0, io.SeekEnd); err != nil {
+		return err
+	}
+	f.tail = make([]byte, min(f.offset, tailSize))
+	_, err = file.ReadAt(f.tail, f.offset-int64(len(f.tail)))
+	return err
+}
+
+// poll reads complete lines written since the last poll
+func (f *follower) poll(emit func(line []byte)) error {
+	if f.file == nil {
+		// Files appearing after start, or after rotation, are read from the beginning
+		if err := f.open(true); err != nil || f.file == nil {
+			return err
+		}
+	}
+
+	truncated, err := f.truncated()
+	if err != nil {
+		return err
+	}
+	if truncated {
+		if _, err := f.file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		f.offset = 0
+		f.partial = f.partial[:0]
+		f.tail = f.tail[:0]
+	}
+	if err := f.drain(emit); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(f.path)
+	switch {
+	case os.IsNotExist(err):
+		// Rotated away and not recreated yet; the old file has been drained
+		f.close()
+		return nil
+	case err != nil:
+		return err
+	case !os.SameFile(info, f.info):
+		// Rotated: the old file has been drained, continue with the new one
+		f.close()
+		if err := f.open(true); err != nil || f.file == nil {
+			return err
+		}
+		return f.drain(emit)
+	}
+	return nil
+}
+
+// truncated reports whether the file was truncated in place since the last
+// read: it is shorter than the offset, or the bytes before the offset changed
+// because it was truncated and written past the offset again (copytruncate)
+func (f *follower) truncated() (bool, error) {
+	info, err := f.file.Stat()
+	if err != nil {
+		return false, err
+	}
+	if info.Size() < f.offset {
+		return true, nil
+	}
+	if len(f.tail) == 0 {
+		return false, nil
+	}
+	buf := make([]byte, len(f.tail))
+	if _, err := f.file.ReadAt(buf, f.offset-int64(len(buf))); err != nil {
+		return false, err
+	}
+	return !bytes.Equal(buf, f.tail), nil
+}
+
+// drain reads the file to its current end and emits complete lines
+func (f *follower) drain(emit func(line []byte)) error {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := f.file.Read(buf)
+		if n > 0 {
+			f.offset += int64(n)
+			data := buf[:n]
+			f.tail = append(f.tail, data[max(0, n-tailSize):]...)
+			if len(f.tail) > tailSize {
+				f.tail = append(f.tail[:0], f.tail[len(f.tail)-tailSize:]...)
+			}
+			for {
+				i := bytes.IndexByte(data, '\n')
+				if i < 0 {
+					f.partial = append(f.partial, data...)
+					if len(f.partial) >= maxLineSize {
+						emit(f.partial)
+						f.partial = f.partial[:0]
+					}
+					break
+				}
+				if len(f.partial) > 0 {
+					f.partial = append(f.partial, data[:i]...)
+					emit(f.partial)
+					f.partial = f.partial[:0]
+				} else {
+					emit(data[:i])
+				}
+				data = data[i+1:]
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// close releases the file
+func (f *follower) close() {
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+}
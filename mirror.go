@@ -0,0 +1,156 @@
+package whooktown
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// MirrorConfig configures shadow mirroring of sensor traffic
+type MirrorConfig struct {
+	// RemapIDs translates primary sensor IDs to secondary sensor IDs
+	RemapIDs map[uuid.UUID]uuid.UUID
+
+	// OnlyMapped mirrors only sensors present in RemapIDs
+	OnlyMapped bool
+
+	// Timeout bounds each secondary send (default: 10s)
+	Timeout time.Duration
+
+	// MaxInFlight bounds concurrent secondary sends; further mirrors are
+	// dropped and reported (default: 32)
+	MaxInFlight int
+
+	// OnError is called when a secondary send fails or is dropped.
+	// Mirror errors never affect the primary call.
+	OnError func(id uuid.UUID, err error)
+}
+
+// MirrorSensors sends sensor data to a primary client and, in the background,
+// to a secondary client such as a DEV environment. The primary result is
+// returned unchanged; the secondary never delays or fails the primary call.
+type MirrorSensors struct {
+	primary   *SensorsClient
+	secondary *SensorsClient
+	config    MirrorConfig
+
+	slots chan struct{}
+	wg    sync.WaitGroup
+}
+
+// NewMirror creates a mirror sending to the sensors of both clients
+func NewMirror(primary, secondary *Client, config MirrorConfig) *MirrorSensors {
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	if config.MaxInFlight <= 0 {
+		config.MaxInFlight = 32
+	}
+	return &MirrorSensors{
+		primary:   primary.Sensors,
+		secondary: secondary.Sensors,
+		config:    config,
+		slots:     make(chan struct{}, config.MaxInFlight),
+	}
+}
+
+// Send sends sensor data to the primary and mirrors it to the secondary.
+// The mirror sends a deep copy, so data may be reused once Send returns.
+func (m *MirrorSensors) Send(ctx context.Context, data *SensorData) error {
+	if id, ok := m.remap(data.ID); ok {
+		d := data.Clone()
+		d.ID = id
+		m.mirror(ctx, id, func(ctx context.Context) error {
+			return m.secondary.Send(ctx, d)
+		})
+	}
+	return m.primary.Send(ctx, data)
+}
+
+// SendRaw sends raw sensor data to the primary and mirrors it to the secondary.
+// The mirror sends a copy of data, including nested map[string]interface{}
+// and []interface{} values.
+func (m *MirrorSensors) SendRaw(ctx context.Context, data map[string]interface{}) error {
+	primaryID := rawSensorID(data)
+	if id, ok := m.remap(primaryID); ok {
+		d := cloneValue(data).(map[string]interface{})
+		if id != primaryID {
+			d["id"] = id.String()
+		}
+		m.mirror(ctx, id, func(ctx context.Context) error {
+			return m.secondary.SendRaw(ctx, d)
+		})
+	}
+	return m.primary.SendRaw(ctx, data)
+}
+
+// SendMultiple sends multiple sensor data points, mirroring each
+func (m *MirrorSensors) SendMultiple(ctx context.Context, data []*SensorData) error {
+	for _, d := range data {
+		if err := m.Send(ctx, d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Wait blocks until in-flight mirror sends are done
+func (m *MirrorSensors) Wait() {
+	m.wg.Wait()
+}
+
+// remap returns the secondary sensor ID, or false if the sensor is not mirrored
+func (m *MirrorSensors) remap(id uuid.UUID) (uuid.UUID, bool) {
+	if mapped, ok := m.config.RemapIDs[id]; ok {
+		return mapped, true
+	}
+	return id, !m.config.OnlyMapped
+}
+
+// mirror runs a secondary send in the background, detached from the caller's
+// cancellation
+func (m *MirrorSensors) mirror(ctx context.Context, id uuid.UUID, send func(ctx context.Context) error) {
+	select {
+	case m.slots <- struct{}{}:
+	default:
+		m.reportError(id, NewError(ErrOverloaded, fmt.Sprintf("mirror dropped: %d sends in flight", m.config.MaxInFlight)))
+		return
+	}
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer func() { <-m.slots }()
+
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), m.config.Timeout)
+		defer cancel()
+		if err := send(ctx); err != nil {
+			m.reportError(id, err)
+		}
+	}()
+}
+
+// reportError forwards a mirror error to the configured handler
+func (m *MirrorSensors) reportError(id uuid.UUID, err error) {
+	if m.config.OnError != nil {
+		m.config.OnError(id, err)
+	}
+}
+
+// rawSensorID returns the sensor ID of a raw payload, or uuid.Nil
+func rawSensorID(data map[string]interface{}) uuid.UUID {
+	switch v := data["id"].(type) {
+	case uuid.UUID:
+		return v
+	case string:
+		id, _ := uuid.FromString(v)
+		return id
+	case fmt.Stringer:
+		id, _ := uuid.FromString(v.String())
+		return id
+	}
+	return uuid.Nil
+}
@@ -0,0 +1,331 @@
+// Package nagios runs Nagios/Icinga-compatible check plugins and reflects
+// their results as whooktown building status.
+package nagios
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"sync"
+	"time"
+
+	whooktown "github.com/fredericalix/whooktown-golang-sdk"
+	"github.com/gofrs/uuid"
+)
+
+// Plugin exit codes
+const (
+	ExitOK       = 0
+	ExitWarning  = 1
+	ExitCritical = 2
+	ExitUnknown  = 3
+)
+
+// StatusFromExitCode maps a plugin exit code to a status.
+// UNKNOWN and any unexpected code map to offline.
+func StatusFromExitCode(code int) whooktown.Status {
+	switch code {
+	case ExitOK:
+		return whooktown.StatusOnline
+	case ExitWarning:
+		return whooktown.StatusWarning
+	case ExitCritical:
+		return whooktown.StatusCritical
+	}
+	return whooktown.StatusOffline
+}
+
+// FieldMapping maps a perfdata label to a SensorData field
+type FieldMapping struct {
+	Label     string // Perfdata label, e.g. "load1"
+	Field     string // SensorData JSON field name, e.g. "cpuUsage"
+	Normalize bool   // Scale to 0-100 using the unit or min/max
+}
+
+// Check is a plugin command mapped to a sensor
+type Check struct {
+	Name     string
+	SensorID uuid.UUID
+
+	Command []string      // Plugin path and arguments
+	Dir     string        // Working directory
+	Env     []string      // Extra environment, "KEY=value"
+	Timeout time.Duration // Default: 60s; a timeout reports UNKNOWN
+
+	Fields    []FieldMapping // Perfdata copied into sensor fields
+	Bands     []string       // Perfdata labels sent as MonitorTube bands, scaled to 0-100
+	TextField string         // Field receiving the first output line, e.g. "towerText"
+}
+
+// Validate checks the check configuration
+func (c *Check) Validate() error {
+	if c.Name == "" {
+		return whooktown.NewError(whooktown.ErrValidation, "nagios check name is required")
+	}
+	if len(c.Command) == 0 {
+		return whooktown.NewError(whooktown.ErrValidation, fmt.Sprintf("nagios check %s: command is required", c.Name))
+	}
+	if c.TextField != "" {
+		if err := whooktown.ValidateField(c.TextField); err != nil {
+			return whooktown.NewErrorWithCause(whooktown.ErrValidation, fmt.Sprintf("nagios check %s: invalid text field", c.Name), err)
+		}
+	}
+	for _, m := range c.Fields {
+		if err := whooktown.ValidateField(m.Field); err != nil {
+			return whooktown.NewErrorWithCause(whooktown.ErrValidation, fmt.Sprintf("nagios check %s: invalid field for %s", c.Name, m.Label), err)
+		}
+	}
+	return nil
+}
+
+// Result is the outcome of a single plugin run
+type Result struct {
+	Name       string
+	SensorID   uuid.UUID
+	Status     whooktown.Status
+	ExitCode   int
+	Text       string // First output line
+	LongText   string
+	Perfdata   []Perfdata
+	Duration   time.Duration
+	Err        error // Run failure or perfdata that could not be mapped
+	CheckedAt  time.Time
+	sensorData *whooktown.SensorData
+}
+
+// SensorData returns the sensor update built from the result
+func (r *Result) SensorData() *whooktown.SensorData {
+	return r.sensorData
+}
+
+// Run executes the plugin and parses its output
+func (c *Check) Run(ctx context.Context) Result {
+	result := Result{
+		Name:      c.Name,
+		SensorID:  c.SensorID,
+		CheckedAt: time.Now(),
+	}
+
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = 60 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, c.Command[0], c.Command[1:]...)
+	cmd.Dir = c.Dir
+	if len(c.Env) > 0 {
+		cmd.Env = append(cmd.Environ(), c.Env...)
+	}
+	// Don't wait forever on children that keep stdout open after a kill
+	cmd.WaitDelay = time.Second
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+
+	start := time.Now()
+	err := cmd.Run()
+	result.Duration = time.Since(start)
+
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		result.ExitCode = ExitUnknown
+		result.Err = fmt.Errorf("timed out after %s", timeout)
+		result.Text = fmt.Sprintf("UNKNOWN: check timed out after %s", timeout)
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitCode()
+	case err != nil:
+		result.ExitCode = ExitUnknown
+		result.Err = err
+		result.Text = fmt.Sprintf("UNKNOWN: %v", err)
+	}
+	if result.Err == nil {
+		result.Text, result.LongText, result.Perfdata = ParseOutput(stdout.String())
+	}
+	result.Status = StatusFromExitCode(result.ExitCode)
+	result.sensorData, err = c.sensorData(&result)
+	result.Err = errors.Join(result.Err, err)
+	return result
+}
+
+// sensorData maps a result to a sensor update. Values that cannot be set
+// are skipped and their errors joined.
+func (c *Check) sensorData(r *Result) (*whooktown.SensorData, error) {
+	data := &whooktown.SensorData{
+		ID:     c.SensorID,
+		Status: r.Status,
+	}
+	var errs []error
+	if c.TextField != "" && r.Text != "" {
+		if err := data.SetField(c.TextField, r.Text); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	perf := make(map[string]*Perfdata, len(r.Perfdata))
+	for i := range r.Perfdata {
+		perf[r.Perfdata[i].Label] = &r.Perfdata[i]
+	}
+	for _, m := range c.Fields {
+		p, ok := perf[m.Label]
+		if !ok {
+			continue
+		}
+		v := p.Value
+		if m.Normalize {
+			if v, ok = p.Percent(); !ok {
+				continue
+			}
+			v = clamp(v)
+		}
+		if err := data.SetField(m.Field, v); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, label := range c.Bands {
+		p, ok := perf[label]
+		if !ok {
+			continue
+		}
+		v, ok := p.Percent()
+		if !ok {
+			v = p.Value
+		}
+		data.Bands = append(data.Bands, whooktown.Band{Name: label, Value: int(clamp(v) + 0.5)})
+	}
+	if len(data.Bands) > 0 {
+		data.BandCount = len(data.Bands)
+	}
+	return data, errors.Join(errs...)
+}
+
+// clamp bounds v to 0-100
+func clamp(v float64) float64 {
+	return max(0, min(100, v))
+}
+
+// Config configures a runner
+type Config struct {
+	// Interval between check rounds (default: 60s)
+	Interval time.Duration
+
+	// Concurrency is the maximum number of plugins running at once (default: 8)
+	Concurrency int
+
+	// OnResult is called after every plugin run
+	OnResult func(result Result)
+
+	// OnError is called when sending a result fails
+	OnError func(err error)
+}
+
+// Runner executes checks on a schedule and sends their results to mapped sensors
+type Runner struct {
+	sensors whooktown.SensorSender
+	config  Config
+
+	mu      sync.RWMutex
+	checks  []*Check
+	results map[string]Result
+}
+
+// New creates a runner sending results to sensors.
+// sensors may be nil to only collect results in-process.
+func New(sensors whooktown.SensorSender, config Config) *Runner {
+	if config.Interval <= 0 {
+		config.Interval = 60 * time.Second
+	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = 8
+	}
+	return &Runner{
+		sensors: sensors,
+		config:  config,
+		results: make(map[string]Result),
+	}
+}
+
+// Add registers a check
+func (r *Runner) Add(check *Check) error {
+	if err := check.Validate(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks = append(r.checks, check)
+	return nil
+}
+
+// RunOnce runs every check, sends results and returns them
+func (r *Runner) RunOnce(ctx context.Context) []Result {
+	r.mu.RLock()
+	checks := append([]*Check(nil), r.checks...)
+	r.mu.RUnlock()
+
+	results := make([]Result, len(checks))
+	sem := make(chan struct{}, r.config.Concurrency)
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, check *Check) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = check.Run(ctx)
+		}(i, check)
+	}
+	wg.Wait()
+
+	r.mu.Lock()
+	for _, res := range results {
+		r.results[res.Name] = res
+	}
+	r.mu.Unlock()
+
+	for _, res := range results {
+		if r.config.OnResult != nil {
+			r.config.OnResult(res)
+		}
+		if r.sensors == nil || res.SensorID == uuid.Nil {
+			continue
+		}
+		if err := r.sensors.Send(ctx, res.SensorData()); err != nil && r.config.OnError != nil {
+			r.config.OnError(err)
+		}
+	}
+	return results
+}
+
+// Run runs checks every Interval until the context is cancelled
+func (r *Runner) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.config.Interval)
+	defer ticker.Stop()
+
+	r.RunOnce(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			r.RunOnce(ctx)
+		}
+	}
+}
+
+// Results returns the latest result of every check, sorted by name
+func (r *Runner) Results() []Result {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	results := make([]Result, 0, len(r.results))
+	for _, res := range r.results {
+		results = append(results, res)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Name < results[j].Name
+	})
+	return results
+}
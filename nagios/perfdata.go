@@ -0,0 +1,155 @@
+package nagios
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Perfdata is a single performance data entry of a plugin output,
+// e.g. 'load1'=0.52;5;10;0
+type Perfdata struct {
+	Label string
+	Value float64
+	UOM   string // Unit of measure: "", s, ms, us, %, B, KB, MB, TB or c
+	Warn  string // Warning range as reported by the plugin
+	Crit  string // Critical range as reported by the plugin
+	Min   *float64
+	Max   *float64
+}
+
+// Percent returns the value scaled to 0-100. Percentages are returned as-is;
+// other values need a Max (Min defaults to 0).
+func (p *Perfdata) Percent() (float64, bool) {
+	if p.UOM == "%" {
+		return p.Value, true
+	}
+	if p.Max == nil {
+		return 0, false
+	}
+	lo := 0.0
+	if p.Min != nil {
+		lo = *p.Min
+	}
+	if *p.Max <= lo {
+		return 0, false
+	}
+	return (p.Value - lo) / (*p.Max - lo) * 100, true
+}
+
+// ParseOutput splits plugin output into the first line of text, the long
+// text of the following lines and the performance data of both
+func ParseOutput(output string) (text, long string, perf []Perfdata) {
+	output = strings.TrimRight(output, "\r\n")
+	first, rest, _ := strings.Cut(output, "\n")
+
+	text, perfText, _ := strings.Cut(first, "|")
+	text = strings.TrimSpace(text)
+
+	// Long output ends at the first '|', after which everything is perfdata
+	longText, longPerf, hasPerf := strings.Cut(rest, "|")
+	long = strings.TrimSpace(longText)
+	if hasPerf {
+		perfText += " " + strings.ReplaceAll(longPerf, "\n", " ")
+	}
+	return text, long, ParsePerfdata(perfText)
+}
+
+// ParsePerfdata parses a space separated list of performance data entries.
+// Malformed entries and undetermined ("U") values are skipped.
+func ParsePerfdata(s string) []Perfdata {
+	var perf []Perfdata
+	for _, token := range splitPerfdata(s) {
+		label, value, ok := cutLabel(token)
+		if !ok {
+			continue
+		}
+		if len(label) >= 2 && label[0] == '\'' && label[len(label)-1] == '\'' {
+			label = strings.ReplaceAll(label[1:len(label)-1], "''", "'")
+		}
+		if label == "" {
+			continue
+		}
+
+		parts := strings.Split(value, ";")
+		num, uom := splitUOM(parts[0])
+		v, err := strconv.ParseFloat(num, 64)
+		if err != nil {
+			continue
+		}
+		p := Perfdata{Label: label, Value: v, UOM: uom}
+		if len(parts) > 1 {
+			p.Warn = parts[1]
+		}
+		if len(parts) > 2 {
+			p.Crit = parts[2]
+		}
+		if len(parts) > 3 {
+			p.Min = parseOptional(parts[3])
+		}
+		if len(parts) > 4 {
+			p.Max = parseOptional(parts[4])
+		}
+		perf = append(perf, p)
+	}
+	return perf
+}
+
+// splitPerfdata splits on spaces outside single-quoted labels
+func splitPerfdata(s string) []string {
+	var tokens []string
+	var b strings.Builder
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\'':
+			quoted = !quoted
+			b.WriteByte(c)
+		case (c == ' ' || c == '\t') && !quoted:
+			if b.Len() > 0 {
+				tokens = append(tokens, b.String())
+				b.Reset()
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	if b.Len() > 0 {
+		tokens = append(tokens, b.String())
+	}
+	return tokens
+}
+
+// cutLabel splits an entry at the first '=' outside a single-quoted label
+func cutLabel(token string) (label, value string, ok bool) {
+	quoted := false
+	for i := 0; i < len(token); i++ {
+		switch token[i] {
+		case '\'':
+			quoted = !quoted
+		case '=':
+			if !quoted {
+				return token[:i], token[i+1:], true
+			}
+		}
+	}
+	return token, "", false
+}
+
+// splitUOM separates the numeric part of a value from its unit
+func splitUOM(s string) (string, string) {
+	i := len(s)
+	for i > 0 && !(s[i-1] >= '0' && s[i-1] <= '9' || s[i-1] == '.') {
+		i--
+	}
+	return s[:i], s[i:]
+}
+
+// parseOptional parses an optional numeric field
+func parseOptional(s string) *float64 {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil
+	}
+	return &v
+}
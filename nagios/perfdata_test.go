@@ -0,0 +1,31 @@
+package nagios
+
+import "testing"
+
+func TestParsePerfdataQuotedLabels(t *testing.T) {
+	perf := ParsePerfdata(`'a=b'=5;1;2 'it''s'=3% 'disk /var'=40MB;;;0;100 plain=1`)
+	want := []struct {
+		label string
+		value float64
+		uom   string
+	}{
+		{"a=b", 5, ""},
+		{"it's", 3, "%"},
+		{"disk /var", 40, "MB"},
+		{"plain", 1, ""},
+	}
+	if len(perf) != len(want) {
+		t.Fatalf("got %d entries, want %d: %+v", len(perf), len(want), perf)
+	}
+	for i, w := range want {
+		if perf[i].Label != w.label || perf[i].Value != w.value || perf[i].UOM != w.uom {
+			t.Errorf("entry %d = %q %v %q, want %q %v %q", i, perf[i].Label, perf[i].Value, perf[i].UOM, w.label, w.value, w.uom)
+		}
+	}
+	if perf[0].Warn != "1" || perf[0].Crit != "2" {
+		t.Errorf("ranges = %q %q, want 1 2", perf[0].Warn, perf[0].Crit)
+	}
+	if p, ok := perf[2].Percent(); !ok || p != 40 {
+		t.Errorf("percent = %v, %v, want 40", p, ok)
+	}
+}
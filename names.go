@@ -0,0 +1,183 @@
+package whooktown
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/gofrs/uuid"
+)
+
+// NamespaceWhooktown is the default namespace of IDs derived from names
+var NamespaceWhooktown = uuid.NewV5(uuid.NamespaceURL, "https://whook.town")
+
+// IDFromName derives a stable UUIDv5 from a namespace and a name such as "prod/payments-api".
+// A nil namespace uses NamespaceWhooktown.
+func IDFromName(namespace uuid.UUID, name string) uuid.UUID {
+	if namespace == uuid.Nil {
+		namespace = NamespaceWhooktown
+	}
+	return uuid.NewV5(namespace, name)
+}
+
+// Registry resolves human names to sensor and building IDs and back.
+// Names are derived with IDFromName unless registered with an explicit ID,
+// e.g. for IDs that predate the registry.
+type Registry struct {
+	namespace uuid.UUID
+
+	mu     sync.RWMutex
+	byName map[string]uuid.UUID
+	byID   map[uuid.UUID]string
+}
+
+// NewRegistry creates a registry deriving IDs in namespace (nil: NamespaceWhooktown)
+func NewRegistry(namespace uuid.UUID) *Registry {
+	if namespace == uuid.Nil {
+		namespace = NamespaceWhooktown
+	}
+	return &Registry{
+		namespace: namespace,
+		byName:    make(map[string]uuid.UUID),
+		byID:      make(map[uuid.UUID]string),
+	}
+}
+
+// LoadRegistry creates a registry from a JSON file mapping names to IDs
+func LoadRegistry(namespace uuid.UUID, path string) (*Registry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, NewErrorWithCause(ErrValidation, fmt.Sprintf("failed to read registry %s", path), err)
+	}
+	r := NewRegistry(namespace)
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ID returns the ID of a name, deriving and recording it if the name is unknown
+func (r *Registry) ID(name string) uuid.UUID {
+	r.mu.RLock()
+	id, ok := r.byName[name]
+	r.mu.RUnlock()
+	if ok {
+		return id
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if id, ok := r.byName[name]; ok {
+		return id
+	}
+	id = IDFromName(r.namespace, name)
+	r.byName[name] = id
+	if _, taken := r.byID[id]; !taken {
+		r.byID[id] = name
+	}
+	return id
+}
+
+// Register maps a name to an explicit ID.
+// It fails if the name or the ID is already mapped differently.
+func (r *Registry) Register(name string, id uuid.UUID) error {
+	if name == "" || id == uuid.Nil {
+		return NewError(ErrValidation, "registry name and id are required")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.byName[name]; ok && existing != id {
+		return NewError(ErrValidation, fmt.Sprintf("name %q is already registered as %s", name, existing))
+	}
+	if existing, ok := r.byID[id]; ok && existing != name {
+		return NewError(ErrValidation, fmt.Sprintf("id %s is already registered as %q", id, existing))
+	}
+	r.byName[name] = id
+	r.byID[id] = name
+	return nil
+}
+
+// Lookup returns the ID of a known name without deriving it
+func (r *Registry) Lookup(name string) (uuid.UUID, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	id, ok := r.byName[name]
+	return id, ok
+}
+
+// Name returns the name of a known ID
+func (r *Registry) Name(id uuid.UUID) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	name, ok := r.byID[id]
+	return name, ok
+}
+
+// Names returns the known names, sorted
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.byName))
+	for name := range r.byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SensorData returns sensor data addressed to a named sensor
+func (r *Registry) SensorData(name string) *SensorData {
+	return &SensorData{ID: r.ID(name)}
+}
+
+// Building returns a building whose ID is derived from its name
+func (r *Registry) Building(name, buildingType string, x, y int) Building {
+	return Building{
+		ID:       r.ID(name),
+		Name:     name,
+		Type:     buildingType,
+		Location: Location{X: x, Y: y},
+	}
+}
+
+// ResolveLayout sets the ID of every building that has a name but no ID
+func (r *Registry) ResolveLayout(layout *Layout) {
+	for i := range layout.Buildings {
+		b := &layout.Buildings[i]
+		if b.ID == uuid.Nil && b.Name != "" {
+			b.ID = r.ID(b.Name)
+		}
+	}
+}
+
+// MarshalJSON encodes the registry as an object mapping names to IDs
+func (r *Registry) MarshalJSON() ([]byte, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return json.Marshal(r.byName)
+}
+
+// UnmarshalJSON registers the names and IDs of a JSON object
+func (r *Registry) UnmarshalJSON(data []byte) error {
+	var names map[string]uuid.UUID
+	if err := json.Unmarshal(data, &names); err != nil {
+		return NewErrorWithCause(ErrValidation, "invalid registry", err)
+	}
+	r.mu.Lock()
+	if r.namespace == uuid.Nil {
+		r.namespace = NamespaceWhooktown
+	}
+	if r.byName == nil {
+		r.byName = make(map[string]uuid.UUID)
+		r.byID = make(map[uuid.UUID]string)
+	}
+	r.mu.Unlock()
+	for name, id := range names {
+		if err := r.Register(name, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -59,6 +59,9 @@ type Config struct {
 	RetryWait  time.Duration
 	HTTPClient *http.Client
 
+	// Sensors
+	StatusPolicy *StatusPolicy // Applied to SensorData before sending
+
 	// Debug
 	Debug bool
 }
@@ -166,6 +169,13 @@ func WithRetry(maxRetries int, retryWait time.Duration) Option {
 	}
 }
 
+// WithStatusPolicy sets a status policy applied to sensor data before sending
+func WithStatusPolicy(policy *StatusPolicy) Option {
+	return func(c *Config) {
+		c.StatusPolicy = policy
+	}
+}
+
 // WithDebug enables debug logging
 func WithDebug(debug bool) Option {
 	return func(c *Config) {
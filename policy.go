@@ -0,0 +1,267 @@
+package whooktown
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+)
+
+// Threshold defines warning and critical bounds for a single metric.
+// Metric is a SensorData JSON field name (e.g. "cpuUsage") or an Extra key.
+type Threshold struct {
+	Metric   string   `json:"metric"`
+	Warning  *float64 `json:"warning,omitempty"`
+	Critical *float64 `json:"critical,omitempty"`
+	Below    bool     `json:"below,omitempty"` // Lower values are worse (e.g. free disk space)
+	Zero     bool     `json:"zero,omitempty"`  // A built-in field left at zero is a reading, not missing
+}
+
+// ActivityBand derives activity from a metric: values below Slow are slow,
+// values at or above Fast are fast, anything in between is normal
+type ActivityBand struct {
+	Metric string  `json:"metric"`
+	Slow   float64 `json:"slow"`
+	Fast   float64 `json:"fast"`
+	Zero   bool    `json:"zero,omitempty"` // A built-in field left at zero is a reading, not missing
+}
+
+// StatusPolicy maps numeric metrics to Status and Activity using declarative thresholds.
+// The status is the worst status of all thresholds; the activity is fast if any band
+// is fast, slow if all bands are slow, and normal otherwise.
+type StatusPolicy struct {
+	Thresholds []Threshold    `json:"thresholds"`
+	Activity   []ActivityBand `json:"activity,omitempty"`
+
+	// AlertActivity overrides the band activity when the status is warning or critical
+	AlertActivity Activity `json:"alert_activity,omitempty"`
+
+	// Override replaces Status and Activity already set on the data.
+	// By default only empty fields are filled in.
+	Override bool `json:"override,omitempty"`
+}
+
+// ParseStatusPolicy decodes and validates a JSON status policy
+func ParseStatusPolicy(data []byte) (*StatusPolicy, error) {
+	var p StatusPolicy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, NewErrorWithCause(ErrValidation, "invalid status policy", err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// LoadStatusPolicy reads a JSON status policy from a file
+func LoadStatusPolicy(path string) (*StatusPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, NewErrorWithCause(ErrValidation, "failed to read status policy", err)
+	}
+	return ParseStatusPolicy(data)
+}
+
+// Validate checks that every threshold and band is consistent
+func (p *StatusPolicy) Validate() error {
+	for _, t := range p.Thresholds {
+		if t.Metric == "" {
+			return NewError(ErrValidation, "threshold metric is required")
+		}
+		if t.Warning == nil && t.Critical == nil {
+			return NewError(ErrValidation, fmt.Sprintf("threshold %s has no bounds", t.Metric))
+		}
+		if t.Warning != nil && t.Critical != nil {
+			if (!t.Below && *t.Warning > *t.Critical) || (t.Below && *t.Warning < *t.Critical) {
+				return NewError(ErrValidation, fmt.Sprintf("threshold %s: warning bound is past critical bound", t.Metric))
+			}
+		}
+	}
+	for _, b := range p.Activity {
+		if b.Metric == "" {
+			return NewError(ErrValidation, "activity band metric is required")
+		}
+		if b.Slow > b.Fast {
+			return NewError(ErrValidation, fmt.Sprintf("activity band %s: slow bound is above fast bound", b.Metric))
+		}
+	}
+	return nil
+}
+
+// Evaluate derives status and activity from metric values.
+// Thresholds and bands whose metric is missing are skipped; an empty
+// result means nothing could be evaluated. See SensorData.Metrics for
+// which fields count as present, and Zero for built-in fields at zero.
+func (p *StatusPolicy) Evaluate(metrics map[string]float64) (Status, Activity) {
+	var status Status
+	for _, t := range p.Thresholds {
+		v, ok := metrics[t.Metric]
+		if !ok {
+			continue
+		}
+		status = WorstStatus(status, t.evaluate(v))
+	}
+
+	var activity Activity
+	for _, b := range p.Activity {
+		v, ok := metrics[b.Metric]
+		if !ok {
+			continue
+		}
+		switch {
+		case v >= b.Fast:
+			activity = ActivityFast
+		case v < b.Slow:
+			if activity == "" {
+				activity = ActivitySlow
+			}
+		default:
+			if activity != ActivityFast {
+				activity = ActivityNormal
+			}
+		}
+	}
+
+	if p.AlertActivity != "" && (status == StatusWarning || status == StatusCritical) {
+		activity = p.AlertActivity
+	}
+	return status, activity
+}
+
+// Apply evaluates the policy against the numeric fields of data and
+// sets its Status and Activity
+func (p *StatusPolicy) Apply(data *SensorData) {
+	status, activity := p.Evaluate(p.metrics(data))
+	if status != "" && (p.Override || data.Status == "") {
+		data.Status = status
+	}
+	if activity != "" && (p.Override || data.Activity == "") {
+		data.Activity = activity
+	}
+}
+
+// metrics returns the metrics of data, adding the built-in fields left at
+// zero that a threshold or band with Zero set evaluates
+func (p *StatusPolicy) metrics(data *SensorData) map[string]float64 {
+	metrics := data.Metrics()
+	for _, t := range p.Thresholds {
+		if t.Zero {
+			addZeroMetric(metrics, t.Metric)
+		}
+	}
+	for _, b := range p.Activity {
+		if b.Zero {
+			addZeroMetric(metrics, b.Metric)
+		}
+	}
+	return metrics
+}
+
+// addZeroMetric records a missing built-in numeric field as a zero reading
+func addZeroMetric(metrics map[string]float64, name string) {
+	if _, ok := metrics[name]; ok {
+		return
+	}
+	if i, ok := sensorDataFields[name]; ok && reflect.TypeOf(SensorData{}).Field(i).Type.Kind() == reflect.Int {
+		metrics[name] = 0
+	}
+}
+
+// evaluate returns the status for a single metric value
+func (t *Threshold) evaluate(v float64) Status {
+	exceeds := func(bound *float64) bool {
+		if bound == nil {
+			return false
+		}
+		if t.Below {
+			return v <= *bound
+		}
+		return v >= *bound
+	}
+	switch {
+	case exceeds(t.Critical):
+		return StatusCritical
+	case exceeds(t.Warning):
+		return StatusWarning
+	}
+	return StatusOnline
+}
+
+// Metrics returns the numeric fields of the sensor data keyed by JSON name,
+// including numeric Extra values. Built-in fields that are zero are left out:
+// they are omitted when sent, so an update that does not set them is not
+// evaluated against them. Extra values are included even when zero.
+// StatusPolicy and Hysteresis add zero built-in fields back for thresholds
+// and bands that set Zero.
+func (s *SensorData) Metrics() map[string]float64 {
+	metrics := make(map[string]float64)
+	v := reflect.ValueOf(s).Elem()
+	for name, i := range sensorDataFields {
+		f := v.Field(i)
+		switch f.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if f.Int() != 0 {
+				metrics[name] = float64(f.Int())
+			}
+		}
+	}
+	for k, val := range s.Extra {
+		if _, exists := metrics[k]; exists {
+			continue
+		}
+		if f, ok := toFloat(val); ok {
+			metrics[k] = f
+		}
+	}
+	return metrics
+}
+
+// toFloat converts a decoded JSON or Go numeric value to float64
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// statusSeverity orders statuses from healthy to worst
+func statusSeverity(s Status) int {
+	switch s {
+	case StatusOnline:
+		return 1
+	case StatusWarning:
+		return 2
+	case StatusCritical:
+		return 3
+	case StatusOffline:
+		return 4
+	}
+	return 0
+}
+
+// WorstStatus returns the more severe of two statuses
+// (online < warning < critical < offline; empty is lowest)
+func WorstStatus(a, b Status) Status {
+	if statusSeverity(b) > statusSeverity(a) {
+		return b
+	}
+	return a
+}
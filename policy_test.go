@@ -0,0 +1,50 @@
+package whooktown
+
+import "testing"
+
+func float(v float64) *float64 { return &v }
+
+func TestPolicySkipsUnsetFields(t *testing.T) {
+	p := &StatusPolicy{
+		Thresholds: []Threshold{{Metric: "amount", Critical: float(10), Below: true}},
+		Activity:   []ActivityBand{{Metric: "cpuUsage", Slow: 10, Fast: 80}},
+	}
+	data := &SensorData{TowerText: "hello"}
+	p.Apply(data)
+	if data.Status != "" || data.Activity != "" {
+		t.Errorf("got %s/%s, want nothing evaluated", data.Status, data.Activity)
+	}
+}
+
+func TestPolicyZeroReading(t *testing.T) {
+	p := &StatusPolicy{
+		Thresholds: []Threshold{
+			{Metric: "activeConnections", Critical: float(1), Below: true, Zero: true},
+			{Metric: "cpuUsage", Warning: float(80), Zero: true},
+		},
+		Activity: []ActivityBand{{Metric: "networkTraffic", Slow: 5, Fast: 50, Zero: true}},
+	}
+	data := &SensorData{}
+	p.Apply(data)
+	if data.Status != StatusCritical {
+		t.Errorf("status = %s, want critical for zero connections", data.Status)
+	}
+	if data.Activity != ActivitySlow {
+		t.Errorf("activity = %s, want slow for zero traffic", data.Activity)
+	}
+
+	data = &SensorData{ActiveConns: 3}
+	p.Apply(data)
+	if data.Status != StatusOnline {
+		t.Errorf("status = %s, want online", data.Status)
+	}
+}
+
+func TestHysteresisZeroReading(t *testing.T) {
+	h := NewHysteresis(nil, HysteresisConfig{
+		Thresholds: []HysteresisThreshold{{Metric: "activeConnections", CriticalEnter: float(1), Below: true, Zero: true}},
+	})
+	if got := h.Filter(&SensorData{}).Status; got != StatusCritical {
+		t.Errorf("status = %s, want critical", got)
+	}
+}
@@ -0,0 +1,149 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	whooktown "github.com/fredericalix/whooktown-golang-sdk"
+	"github.com/gofrs/uuid"
+)
+
+// maxBodySize bounds how much of a response body is matched against BodyRegex
+const maxBodySize = 1 << 20
+
+// HTTPCheck probes an HTTP endpoint.
+// Unreachable endpoints are offline, unexpected responses are critical, and
+// latency drives status through Warning/Critical and activity through FastBelow/SlowAbove.
+type HTTPCheck struct {
+	Name      string
+	SensorID  uuid.UUID
+	TextField TextField // Field receiving the detail text
+
+	URL     string
+	Method  string // Default: GET
+	Headers map[string]string
+	Body    string
+
+	ExpectedStatus int    // Default: any 2xx
+	BodyRegex      string // Response body must match when set
+
+	Timeout  time.Duration // Default: 10s
+	Warning  time.Duration // Latency at or above is warning
+	Critical time.Duration // Latency at or above is critical
+
+	FastBelow time.Duration // Latency below animates fast
+	SlowAbove time.Duration // Latency above animates slowly
+
+	// Client performs the request (default: http.DefaultClient)
+	Client *http.Client
+
+	bodyRe *regexp.Regexp // BodyRegex compiled by Validate
+}
+
+// CheckName returns the name of the check
+func (c *HTTPCheck) CheckName() string {
+	return c.Name
+}
+
+// Validate checks the check configuration and compiles BodyRegex
+func (c *HTTPCheck) Validate() error {
+	if c.Name == "" {
+		return whooktown.NewError(whooktown.ErrValidation, "http check name is required")
+	}
+	if c.URL == "" {
+		return whooktown.NewError(whooktown.ErrValidation, fmt.Sprintf("http check %s: url is required", c.Name))
+	}
+	if c.BodyRegex != "" {
+		re, err := regexp.Compile(c.BodyRegex)
+		if err != nil {
+			return whooktown.NewErrorWithCause(whooktown.ErrValidation, fmt.Sprintf("http check %s: invalid body regex", c.Name), err)
+		}
+		c.bodyRe = re
+	}
+	return nil
+}
+
+// Probe performs the request and evaluates the response
+func (c *HTTPCheck) Probe(ctx context.Context) Result {
+	result := Result{
+		Name:      c.Name,
+		SensorID:  c.SensorID,
+		TextField: c.TextField,
+		CheckedAt: time.Now(),
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, withDefault(c.Timeout))
+	defer cancel()
+
+	method := c.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	var body io.Reader
+	if c.Body != "" {
+		body = strings.NewReader(c.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.URL, body)
+	if err != nil {
+		return result.fail(whooktown.StatusOffline, err)
+	}
+	for k, v := range c.Headers {
+		req.Header.Set(k, v)
+	}
+
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return result.fail(whooktown.StatusOffline, err)
+	}
+	defer resp.Body.Close()
+
+	var respBody []byte
+	if c.BodyRegex != "" {
+		respBody, err = io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	} else {
+		_, err = io.Copy(io.Discard, io.LimitReader(resp.Body, maxBodySize))
+	}
+	result.Latency = time.Since(start)
+	if err != nil {
+		return result.fail(whooktown.StatusOffline, err)
+	}
+
+	if !c.statusOK(resp.StatusCode) {
+		return result.fail(whooktown.StatusCritical, fmt.Errorf("unexpected status %d", resp.StatusCode))
+	}
+	if c.BodyRegex != "" {
+		// Checks probed without Validate compile the regex on each run
+		re := c.bodyRe
+		if re == nil {
+			if re, err = regexp.Compile(c.BodyRegex); err != nil {
+				return result.fail(whooktown.StatusCritical, err)
+			}
+		}
+		if !re.Match(respBody) {
+			return result.fail(whooktown.StatusCritical, fmt.Errorf("body does not match %q", c.BodyRegex))
+		}
+	}
+
+	result.Status = latencyStatus(result.Latency, c.Warning, c.Critical)
+	result.Activity = latencyActivity(result.Latency, c.FastBelow, c.SlowAbove)
+	result.Detail = fmt.Sprintf("%d in %s", resp.StatusCode, result.Latency.Round(time.Millisecond))
+	return result
+}
+
+// statusOK reports whether code is the expected response status
+func (c *HTTPCheck) statusOK(code int) bool {
+	if c.ExpectedStatus == 0 {
+		return code >= 200 && code < 300
+	}
+	return code == c.ExpectedStatus
+}
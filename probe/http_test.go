@@ -0,0 +1,97 @@
+package probe
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	whooktown "github.com/fredericalix/whooktown-golang-sdk"
+)
+
+func TestHTTPCheckStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		path     string
+		expected int
+		want     whooktown.Status
+	}{
+		{"/", 0, whooktown.StatusOnline},
+		{"/down", 0, whooktown.StatusCritical},
+		{"/down", http.StatusServiceUnavailable, whooktown.StatusOnline},
+		{"/", http.StatusNoContent, whooktown.StatusCritical},
+	} {
+		c := &HTTPCheck{Name: "api", URL: srv.URL + tc.path, ExpectedStatus: tc.expected}
+		if r := c.Probe(context.Background()); r.Status != tc.want {
+			t.Errorf("%s expecting %d: got %s (%v), want %s", tc.path, tc.expected, r.Status, r.Err, tc.want)
+		}
+	}
+
+	srv.Close()
+	c := &HTTPCheck{Name: "api", URL: srv.URL}
+	if r := c.Probe(context.Background()); r.Status != whooktown.StatusOffline {
+		t.Errorf("closed server: got %s, want offline", r.Status)
+	}
+}
+
+func TestHTTPCheckLatency(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	c := &HTTPCheck{Name: "api", URL: srv.URL, Warning: 20 * time.Millisecond, Critical: time.Second, SlowAbove: 20 * time.Millisecond}
+	r := c.Probe(context.Background())
+	if r.Status != whooktown.StatusWarning || r.Activity != whooktown.ActivitySlow {
+		t.Errorf("got %s/%s after %s, want warning/slow", r.Status, r.Activity, r.Latency)
+	}
+
+	c = &HTTPCheck{Name: "api", URL: srv.URL, Timeout: 10 * time.Millisecond}
+	if r := c.Probe(context.Background()); r.Status != whooktown.StatusOffline {
+		t.Errorf("timeout: got %s, want offline", r.Status)
+	}
+}
+
+func TestHTTPCheckBodyRegex(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"healthy"}`))
+	}))
+	defer srv.Close()
+
+	p := New(nil, Config{})
+	for name, re := range map[string]string{"match": `"status":"healthy"`, "mismatch": `"status":"ok"`} {
+		if err := p.Add(&HTTPCheck{Name: name, URL: srv.URL, BodyRegex: re}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p.RunOnce(context.Background())
+	if r, _ := p.Result("match"); r.Status != whooktown.StatusOnline {
+		t.Errorf("match: got %s (%v), want online", r.Status, r.Err)
+	}
+	if r, _ := p.Result("mismatch"); r.Status != whooktown.StatusCritical {
+		t.Errorf("mismatch: got %s, want critical", r.Status)
+	}
+
+	if err := p.Add(&HTTPCheck{Name: "bad", URL: srv.URL, BodyRegex: "("}); err == nil {
+		t.Error("invalid regex accepted")
+	}
+}
+
+func TestAddRejectsDuplicateNames(t *testing.T) {
+	p := New(nil, Config{})
+	if err := p.Add(&HTTPCheck{Name: "api", URL: "http://example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Add(&TCPCheck{Name: "api", Address: "example.com:443"}); err == nil {
+		t.Error("duplicate name accepted")
+	}
+}
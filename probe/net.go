@@ -0,0 +1,265 @@
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"time"
+
+	whooktown "github.com/fredericalix/whooktown-golang-sdk"
+	"github.com/gofrs/uuid"
+)
+
+// TCPCheck probes that a TCP endpoint accepts connections.
+// Refused or timed out connections are offline; connect latency drives status and activity.
+type TCPCheck struct {
+	Name      string
+	SensorID  uuid.UUID
+	TextField TextField
+
+	Address string // host:port
+
+	Timeout  time.Duration // Default: 10s
+	Warning  time.Duration // Latency at or above is warning
+	Critical time.Duration // Latency at or above is critical
+
+	FastBelow time.Duration // Latency below animates fast
+	SlowAbove time.Duration // Latency above animates slowly
+}
+
+// CheckName returns the name of the check
+func (c *TCPCheck) CheckName() string {
+	return c.Name
+}
+
+// Validate checks the check configuration
+func (c *TCPCheck) Validate() error {
+	if c.Name == "" {
+		return whooktown.NewError(whooktown.ErrValidation, "tcp check name is required")
+	}
+	if _, _, err := net.SplitHostPort(c.Address); err != nil {
+		return whooktown.NewErrorWithCause(whooktown.ErrValidation, fmt.Sprintf("tcp check %s: invalid address", c.Name), err)
+	}
+	return nil
+}
+
+// Probe opens and closes a connection
+func (c *TCPCheck) Probe(ctx context.Context) Result {
+	result := Result{
+		Name:      c.Name,
+		SensorID:  c.SensorID,
+		TextField: c.TextField,
+		CheckedAt: time.Now(),
+	}
+
+	dialer := net.Dialer{Timeout: withDefault(c.Timeout)}
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", c.Address)
+	result.Latency = time.Since(start)
+	if err != nil {
+		return result.fail(whooktown.StatusOffline, err)
+	}
+	conn.Close()
+
+	result.Status = latencyStatus(result.Latency, c.Warning, c.Critical)
+	result.Activity = latencyActivity(result.Latency, c.FastBelow, c.SlowAbove)
+	result.Detail = fmt.Sprintf("tcp: %s", result.Latency.Round(time.Millisecond))
+	return result
+}
+
+// DNSCheck probes that a host name resolves.
+// Timeouts are offline; resolution failures and unexpected addresses are critical.
+type DNSCheck struct {
+	Name      string
+	SensorID  uuid.UUID
+	TextField TextField
+
+	Host     string
+	Expected []string // Addresses that must all be present when set
+	Server   string   // DNS server host:port (default: system resolver)
+
+	Timeout  time.Duration // Default: 10s
+	Warning  time.Duration // Latency at or above is warning
+	Critical time.Duration // Latency at or above is critical
+
+	FastBelow time.Duration // Latency below animates fast
+	SlowAbove time.Duration // Latency above animates slowly
+}
+
+// CheckName returns the name of the check
+func (c *DNSCheck) CheckName() string {
+	return c.Name
+}
+
+// Validate checks the check configuration
+func (c *DNSCheck) Validate() error {
+	if c.Name == "" {
+		return whooktown.NewError(whooktown.ErrValidation, "dns check name is required")
+	}
+	if c.Host == "" {
+		return whooktown.NewError(whooktown.ErrValidation, fmt.Sprintf("dns check %s: host is required", c.Name))
+	}
+	return nil
+}
+
+// Probe resolves the host
+func (c *DNSCheck) Probe(ctx context.Context) Result {
+	result := Result{
+		Name:      c.Name,
+		SensorID:  c.SensorID,
+		TextField: c.TextField,
+		CheckedAt: time.Now(),
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, withDefault(c.Timeout))
+	defer cancel()
+
+	resolver := net.DefaultResolver
+	if c.Server != "" {
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, c.Server)
+			},
+		}
+	}
+
+	start := time.Now()
+	addrs, err := resolver.LookupHost(ctx, c.Host)
+	result.Latency = time.Since(start)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if (errors.As(err, &dnsErr) && dnsErr.IsTimeout) || errors.Is(err, context.DeadlineExceeded) {
+			return result.fail(whooktown.StatusOffline, err)
+		}
+		return result.fail(whooktown.StatusCritical, err)
+	}
+	for _, want := range c.Expected {
+		if !slices.Contains(addrs, want) {
+			return result.fail(whooktown.StatusCritical, fmt.Errorf("%s does not resolve to %s", c.Host, want))
+		}
+	}
+
+	result.Status = latencyStatus(result.Latency, c.Warning, c.Critical)
+	result.Activity = latencyActivity(result.Latency, c.FastBelow, c.SlowAbove)
+	result.Detail = fmt.Sprintf("dns: %d addr in %s", len(addrs), result.Latency.Round(time.Millisecond))
+	return result
+}
+
+// TLSCheck probes the certificate of a TLS endpoint.
+// Unreachable endpoints and handshake timeouts are offline, invalid or expired certificates are critical,
+// and the remaining validity drives warning and critical status.
+type TLSCheck struct {
+	Name      string
+	SensorID  uuid.UUID
+	TextField TextField
+
+	Address    string // host:port
+	ServerName string // Default: host of Address
+
+	// InsecureSkipVerify only checks expiry, not the certificate chain
+	InsecureSkipVerify bool
+
+	Timeout      time.Duration // Default: 10s
+	WarningDays  int           // Fewer days left is warning (default: 14)
+	CriticalDays int           // Fewer days left is critical (default: 3)
+}
+
+// CheckName returns the name of the check
+func (c *TLSCheck) CheckName() string {
+	return c.Name
+}
+
+// Validate checks the check configuration
+func (c *TLSCheck) Validate() error {
+	if c.Name == "" {
+		return whooktown.NewError(whooktown.ErrValidation, "tls check name is required")
+	}
+	if _, _, err := net.SplitHostPort(c.Address); err != nil {
+		return whooktown.NewErrorWithCause(whooktown.ErrValidation, fmt.Sprintf("tls check %s: invalid address", c.Name), err)
+	}
+	return nil
+}
+
+// Probe performs a TLS handshake and inspects the leaf certificate
+func (c *TLSCheck) Probe(ctx context.Context) Result {
+	result := Result{
+		Name:      c.Name,
+		SensorID:  c.SensorID,
+		TextField: c.TextField,
+		CheckedAt: time.Now(),
+	}
+
+	serverName := c.ServerName
+	if serverName == "" {
+		serverName, _, _ = net.SplitHostPort(c.Address)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, withDefault(c.Timeout))
+	defer cancel()
+
+	dialer := tls.Dialer{Config: &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}}
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", c.Address)
+	result.Latency = time.Since(start)
+	if err != nil {
+		// Network failures, including a handshake that times out, are
+		// offline as for the tcp and http checks; rejected certificates
+		// and handshakes are critical
+		var opErr *net.OpError
+		var netErr net.Error
+		if (errors.As(err, &opErr) && opErr.Op == "dial") ||
+			(errors.As(err, &netErr) && netErr.Timeout()) ||
+			errors.Is(err, context.DeadlineExceeded) {
+			return result.fail(whooktown.StatusOffline, err)
+		}
+		return result.fail(whooktown.StatusCritical, err)
+	}
+	defer conn.Close()
+
+	certs := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return result.fail(whooktown.StatusCritical, errors.New("no peer certificate"))
+	}
+	left := time.Until(certs[0].NotAfter)
+	if left <= 0 {
+		return result.fail(whooktown.StatusCritical, fmt.Errorf("cert: expired %s", certs[0].NotAfter.Format(time.DateOnly)))
+	}
+
+	warningDays, criticalDays := c.WarningDays, c.CriticalDays
+	if warningDays <= 0 {
+		warningDays = 14
+	}
+	if criticalDays <= 0 {
+		criticalDays = 3
+	}
+	days := int(left.Hours() / 24)
+	switch {
+	case days < criticalDays:
+		result.Status = whooktown.StatusCritical
+		result.Activity = whooktown.ActivityFast
+	case days < warningDays:
+		result.Status = whooktown.StatusWarning
+		result.Activity = whooktown.ActivityFast
+	default:
+		result.Status = whooktown.StatusOnline
+		result.Activity = whooktown.ActivityNormal
+	}
+	result.Detail = fmt.Sprintf("cert: %dd left", days)
+	return result
+}
+
+// withDefault returns timeout, or the default probe timeout if unset
+func withDefault(timeout time.Duration) time.Duration {
+	if timeout <= 0 {
+		return 10 * time.Second
+	}
+	return timeout
+}
@@ -0,0 +1,50 @@
+package probe
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	whooktown "github.com/fredericalix/whooktown-golang-sdk"
+)
+
+func TestTLSCheckHandshakeTimeout(t *testing.T) {
+	// Accepts connections but never answers the handshake
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	c := &TLSCheck{Name: "tls", Address: ln.Addr().String(), Timeout: 50 * time.Millisecond}
+	if r := c.Probe(context.Background()); r.Status != whooktown.StatusOffline {
+		t.Errorf("got %s (%v), want offline", r.Status, r.Err)
+	}
+}
+
+func TestTLSCheckUntrustedCertificate(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer srv.Close()
+
+	addr := srv.Listener.Addr().String()
+	c := &TLSCheck{Name: "tls", Address: addr}
+	if r := c.Probe(context.Background()); r.Status != whooktown.StatusCritical {
+		t.Errorf("verified: got %s (%v), want critical", r.Status, r.Err)
+	}
+	c = &TLSCheck{Name: "tls", Address: addr, InsecureSkipVerify: true}
+	if r := c.Probe(context.Background()); r.Status != whooktown.StatusOnline {
+		t.Errorf("insecure: got %s (%v), want online", r.Status, r.Err)
+	}
+}
@@ -0,0 +1,239 @@
+// Package probe runs synthetic checks on a schedule and reflects their
+// outcome as whooktown building status.
+package probe
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	whooktown "github.com/fredericalix/whooktown-golang-sdk"
+	"github.com/gofrs/uuid"
+)
+
+// Check is a synthetic probe
+type Check interface {
+	// Probe runs the check once and returns its result
+	Probe(ctx context.Context) Result
+}
+
+// Named is implemented by checks that know their name before running,
+// so that Add can reject a second check with the same name
+type Named interface {
+	CheckName() string
+}
+
+// TextField selects the SensorData text field that displays a check's detail
+type TextField string
+
+const (
+	TextNone   TextField = ""
+	TextTower  TextField = "towerText"  // TowerA LED text
+	TextTowerB TextField = "towerBText" // TowerB LED text
+	TextSign   TextField = "signText"   // Arcade sign
+	Text1      TextField = "text1"      // DisplayA text
+	Text2      TextField = "text2"      // DisplayA text
+	Text3      TextField = "text3"      // DisplayA text
+)
+
+// Result is the outcome of a single check run
+type Result struct {
+	Name      string
+	SensorID  uuid.UUID
+	Status    whooktown.Status
+	Activity  whooktown.Activity
+	Latency   time.Duration
+	Detail    string // Human readable summary, e.g. "200 in 42ms" or "cert: 9d left"
+	TextField TextField
+	Err       error
+	CheckedAt time.Time
+}
+
+// SensorData converts the result into a sensor update, writing Detail to TextField
+func (r *Result) SensorData() *whooktown.SensorData {
+	data := &whooktown.SensorData{
+		ID:       r.SensorID,
+		Status:   r.Status,
+		Activity: r.Activity,
+	}
+	switch r.TextField {
+	case TextTower:
+		data.TowerText = r.Detail
+	case TextTowerB:
+		data.TowerBText = r.Detail
+	case TextSign:
+		data.SignText = r.Detail
+	case Text1:
+		data.Text1 = r.Detail
+	case Text2:
+		data.Text2 = r.Detail
+	case Text3:
+		data.Text3 = r.Detail
+	}
+	return data
+}
+
+// fail marks the result as failed with the given status
+func (r Result) fail(status whooktown.Status, err error) Result {
+	r.Status = status
+	r.Activity = whooktown.ActivitySlow
+	r.Err = err
+	r.Detail = err.Error()
+	return r
+}
+
+// Config configures a prober
+type Config struct {
+	// Interval between check rounds (default: 30s)
+	Interval time.Duration
+
+	// OnResult is called after every check run
+	OnResult func(result Result)
+
+	// OnError is called when sending a result fails
+	OnError func(err error)
+}
+
+// Prober runs checks on a schedule and sends their results to mapped sensors
+type Prober struct {
+	sensors whooktown.SensorSender
+	config  Config
+
+	mu      sync.RWMutex
+	checks  []Check
+	results map[string]Result
+}
+
+// New creates a prober sending results to sensors.
+// sensors may be nil to only collect results in-process.
+func New(sensors whooktown.SensorSender, config Config) *Prober {
+	if config.Interval <= 0 {
+		config.Interval = 30 * time.Second
+	}
+	return &Prober{
+		sensors: sensors,
+		config:  config,
+		results: make(map[string]Result),
+	}
+}
+
+// Add registers a check, validating it first if it provides a Validate method.
+// Results are kept by name: a check whose name is already registered is rejected.
+func (p *Prober) Add(check Check) error {
+	if v, ok := check.(interface{ Validate() error }); ok {
+		if err := v.Validate(); err != nil {
+			return err
+		}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if n, ok := check.(Named); ok {
+		for _, c := range p.checks {
+			if other, ok := c.(Named); ok && other.CheckName() == n.CheckName() {
+				return whooktown.NewError(whooktown.ErrValidation, fmt.Sprintf("check %s is already registered", n.CheckName()))
+			}
+		}
+	}
+	p.checks = append(p.checks, check)
+	return nil
+}
+
+// RunOnce runs every check concurrently, sends results and returns them
+func (p *Prober) RunOnce(ctx context.Context) []Result {
+	p.mu.RLock()
+	checks := append([]Check(nil), p.checks...)
+	p.mu.RUnlock()
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = check.Probe(ctx)
+		}(i, check)
+	}
+	wg.Wait()
+
+	p.mu.Lock()
+	for _, r := range results {
+		p.results[r.Name] = r
+	}
+	p.mu.Unlock()
+
+	for _, r := range results {
+		if p.config.OnResult != nil {
+			p.config.OnResult(r)
+		}
+		if p.sensors == nil || r.SensorID == uuid.Nil {
+			continue
+		}
+		if err := p.sensors.Send(ctx, r.SensorData()); err != nil && p.config.OnError != nil {
+			p.config.OnError(err)
+		}
+	}
+	return results
+}
+
+// Run runs checks every Interval until the context is cancelled
+func (p *Prober) Run(ctx context.Context) error {
+	ticker := time.NewTicker(p.config.Interval)
+	defer ticker.Stop()
+
+	p.RunOnce(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			p.RunOnce(ctx)
+		}
+	}
+}
+
+// Result returns the latest result of a check by name
+func (p *Prober) Result(name string) (Result, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	r, ok := p.results[name]
+	return r, ok
+}
+
+// Results returns the latest result of every check, sorted by name
+func (p *Prober) Results() []Result {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	results := make([]Result, 0, len(p.results))
+	for _, r := range p.results {
+		results = append(results, r)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Name < results[j].Name
+	})
+	return results
+}
+
+// latencyStatus maps a latency to a status using warning and critical bounds
+func latencyStatus(latency, warning, critical time.Duration) whooktown.Status {
+	switch {
+	case critical > 0 && latency >= critical:
+		return whooktown.StatusCritical
+	case warning > 0 && latency >= warning:
+		return whooktown.StatusWarning
+	}
+	return whooktown.StatusOnline
+}
+
+// latencyActivity maps a latency to an activity: quick responses animate
+// fast, slow responses animate slowly
+func latencyActivity(latency, fastBelow, slowAbove time.Duration) whooktown.Activity {
+	switch {
+	case fastBelow > 0 && latency < fastBelow:
+		return whooktown.ActivityFast
+	case slowAbove > 0 && latency > slowAbove:
+		return whooktown.ActivitySlow
+	}
+	return whooktown.ActivityNormal
+}
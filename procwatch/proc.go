@@ -0,0 +1,102 @@
+package procwatch
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// procInfo describes a running process
+type procInfo struct {
+	pid       int
+	comm      string
+	cmdline   string
+	startTime uint64 // Clock ticks after boot, distinguishes reused PIDs
+}
+
+// listPIDs returns the numeric entries of the proc root
+func listPIDs(procRoot string) ([]int, error) {
+	entries, err := os.ReadDir(procRoot)
+	if err != nil {
+		return nil, err
+	}
+	var pids []int
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil || !e.IsDir() {
+			continue
+		}
+		pids = append(pids, pid)
+	}
+	return pids, nil
+}
+
+// readProc reads the identity of a process from /proc/<pid>
+func readProc(procRoot string, pid int) (procInfo, error) {
+	dir := filepath.Join(procRoot, strconv.Itoa(pid))
+	info := procInfo{pid: pid}
+
+	stat, err := os.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		return info, err
+	}
+	// comm is enclosed in parentheses and may itself contain spaces or parentheses
+	open := bytes.IndexByte(stat, '(')
+	closing := bytes.LastIndexByte(stat, ')')
+	if open < 0 || closing < open {
+		return info, fmt.Errorf("parse %s/stat: malformed", dir)
+	}
+	info.comm = string(stat[open+1 : closing])
+	fields := strings.Fields(string(stat[closing+1:]))
+	// Fields after comm start at field 3 (state); starttime is field 22
+	if len(fields) > 19 {
+		info.startTime, _ = strconv.ParseUint(fields[19], 10, 64)
+	}
+
+	cmdline, err := os.ReadFile(filepath.Join(dir, "cmdline"))
+	if err == nil {
+		info.cmdline = strings.TrimSpace(string(bytes.ReplaceAll(cmdline, []byte{0}, []byte{' '})))
+	}
+	return info, nil
+}
+
+// readRSS returns the resident set size of a process in bytes
+func readRSS(procRoot string, pid int) (uint64, error) {
+	status, err := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "status"))
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(status), "\n") {
+		value, ok := strings.CutPrefix(line, "VmRSS:")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			break
+		}
+		kb, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("parse VmRSS: %w", err)
+		}
+		return kb * 1024, nil
+	}
+	// Kernel threads have no VmRSS
+	return 0, nil
+}
+
+// readPIDFile reads a pid from a pidfile
+func readPIDFile(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("parse pidfile %s: %w", path, err)
+	}
+	return pid, nil
+}
@@ -0,0 +1,346 @@
+// Package procwatch watches processes through /proc and reflects their health
+// as whooktown building status.
+package procwatch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	whooktown "github.com/fredericalix/whooktown-golang-sdk"
+	"github.com/gofrs/uuid"
+)
+
+// Process selects processes by name, pidfile or command line and maps them to a sensor.
+// Exactly one of Comm, PIDFile or Cmdline must be set.
+type Process struct {
+	Name     string    `json:"name"`
+	SensorID uuid.UUID `json:"sensor_id"`
+
+	Comm    string `json:"comm,omitempty"`    // Exact process name as in /proc/<pid>/comm
+	PIDFile string `json:"pidfile,omitempty"` // Path of a pidfile
+	Cmdline string `json:"cmdline,omitempty"` // Regexp matched against the command line
+
+	// MinCount is the number of processes expected (default: 1); fewer is offline
+	MinCount int `json:"min_count,omitempty"`
+
+	// MaxRestarts within RestartWindow (default: 1h) raises a warning (0 disables).
+	// In JSON, restart_window is a duration string such as "30m".
+	MaxRestarts   int           `json:"max_restarts,omitempty"`
+	RestartWindow time.Duration `json:"-"`
+
+	// MaxRSS in bytes, summed over matched processes, raises a warning (0 disables)
+	MaxRSS uint64 `json:"max_rss,omitempty"`
+
+	cmdline *regexp.Regexp
+}
+
+// processJSON is the JSON form of a Process
+type processJSON struct {
+	*processAlias
+	RestartWindow string `json:"restart_window,omitempty"`
+}
+
+type processAlias Process
+
+// MarshalJSON encodes RestartWindow as a duration string
+func (p Process) MarshalJSON() ([]byte, error) {
+	aux := processJSON{processAlias: (*processAlias)(&p)}
+	if p.RestartWindow > 0 {
+		aux.RestartWindow = p.RestartWindow.String()
+	}
+	return json.Marshal(aux)
+}
+
+// UnmarshalJSON decodes RestartWindow from a duration string
+func (p *Process) UnmarshalJSON(data []byte) error {
+	aux := processJSON{processAlias: (*processAlias)(p)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	if aux.RestartWindow != "" {
+		d, err := time.ParseDuration(aux.RestartWindow)
+		if err != nil {
+			return whooktown.NewErrorWithCause(whooktown.ErrValidation, fmt.Sprintf("process %s: invalid restart_window", p.Name), err)
+		}
+		p.RestartWindow = d
+	}
+	return nil
+}
+
+// Validate checks the process configuration
+func (p *Process) Validate() error {
+	if p.Name == "" {
+		return whooktown.NewError(whooktown.ErrValidation, "process name is required")
+	}
+	set := 0
+	for _, s := range []string{p.Comm, p.PIDFile, p.Cmdline} {
+		if s != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return whooktown.NewError(whooktown.ErrValidation, fmt.Sprintf("process %s: exactly one of comm, pidfile or cmdline is required", p.Name))
+	}
+	if p.Cmdline != "" {
+		if _, err := regexp.Compile(p.Cmdline); err != nil {
+			return whooktown.NewErrorWithCause(whooktown.ErrValidation, fmt.Sprintf("process %s: invalid cmdline regexp", p.Name), err)
+		}
+	}
+	return nil
+}
+
+// Result is the state of a watched process at a check
+type Result struct {
+	Name      string
+	SensorID  uuid.UUID
+	Status    whooktown.Status
+	PIDs      []int
+	RSS       uint64 // Bytes, summed over PIDs
+	Restarts  int    // Within the restart window
+	Detail    string
+	CheckedAt time.Time
+}
+
+// SensorData converts the result into a sensor update
+func (r *Result) SensorData() *whooktown.SensorData {
+	return &whooktown.SensorData{
+		ID:     r.SensorID,
+		Status: r.Status,
+	}
+}
+
+// Config configures a watcher
+type Config struct {
+	// ProcRoot is the proc filesystem root (default: /proc).
+	// Point it at a directory of fixture files for testing.
+	ProcRoot string
+
+	// Interval between checks (default: 15s)
+	Interval time.Duration
+
+	Processes []Process
+
+	// OnError is called when reading /proc or sending fails
+	OnError func(err error)
+}
+
+// Watcher checks processes on a schedule and sends their status to mapped sensors
+type Watcher struct {
+	sensors whooktown.SensorSender
+	config  Config
+
+	mu      sync.Mutex
+	state   []*processState
+	results map[string]Result
+}
+
+// processState tracks the instances and restarts of a watched process
+type processState struct {
+	seen     map[procKey]bool
+	restarts []time.Time
+	checked  bool
+}
+
+// procKey identifies a process instance across PID reuse
+type procKey struct {
+	pid       int
+	startTime uint64
+}
+
+// New validates the processes and creates a watcher sending to sensors
+func New(sensors whooktown.SensorSender, config Config) (*Watcher, error) {
+	if config.ProcRoot == "" {
+		config.ProcRoot = "/proc"
+	}
+	if config.Interval <= 0 {
+		config.Interval = 15 * time.Second
+	}
+	processes := make([]Process, len(config.Processes))
+	state := make([]*processState, len(config.Processes))
+	for i, p := range config.Processes {
+		if err := p.Validate(); err != nil {
+			return nil, err
+		}
+		if p.Cmdline != "" {
+			p.cmdline = regexp.MustCompile(p.Cmdline)
+		}
+		if p.MinCount <= 0 {
+			p.MinCount = 1
+		}
+		if p.RestartWindow <= 0 {
+			p.RestartWindow = time.Hour
+		}
+		processes[i] = p
+		state[i] = &processState{seen: make(map[procKey]bool)}
+	}
+	config.Processes = processes
+
+	return &Watcher{
+		sensors: sensors,
+		config:  config,
+		state:   state,
+		results: make(map[string]Result),
+	}, nil
+}
+
+// Check inspects every process, sends results and returns them
+func (w *Watcher) Check(ctx context.Context) []Result {
+	procs, err := w.scan()
+	if err != nil {
+		w.reportError(err)
+		return nil
+	}
+
+	w.mu.Lock()
+	now := time.Now()
+	results := make([]Result, len(w.config.Processes))
+	for i := range w.config.Processes {
+		results[i] = w.evaluate(&w.config.Processes[i], w.state[i], procs, now)
+		w.results[results[i].Name] = results[i]
+	}
+	w.mu.Unlock()
+
+	if w.sensors != nil {
+		for _, r := range results {
+			if r.SensorID == uuid.Nil {
+				continue
+			}
+			if err := w.sensors.Send(ctx, r.SensorData()); err != nil {
+				w.reportError(err)
+			}
+		}
+	}
+	return results
+}
+
+// Run checks processes every Interval until the context is cancelled
+func (w *Watcher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(w.config.Interval)
+	defer ticker.Stop()
+
+	w.Check(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			w.Check(ctx)
+		}
+	}
+}
+
+// Results returns the latest result of every process, sorted by name
+func (w *Watcher) Results() []Result {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	results := make([]Result, 0, len(w.results))
+	for _, r := range w.results {
+		results = append(results, r)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Name < results[j].Name
+	})
+	return results
+}
+
+// scan reads the identity of every running process
+func (w *Watcher) scan() (map[int]procInfo, error) {
+	pids, err := listPIDs(w.config.ProcRoot)
+	if err != nil {
+		return nil, whooktown.NewErrorWithCause(whooktown.ErrIO, "failed to list processes", err)
+	}
+	procs := make(map[int]procInfo, len(pids))
+	for _, pid := range pids {
+		info, err := readProc(w.config.ProcRoot, pid)
+		if err != nil {
+			// The process exited while scanning
+			continue
+		}
+		procs[pid] = info
+	}
+	return procs, nil
+}
+
+// evaluate matches a process against the scan and derives its status
+func (w *Watcher) evaluate(p *Process, st *processState, procs map[int]procInfo, now time.Time) Result {
+	result := Result{
+		Name:      p.Name,
+		SensorID:  p.SensorID,
+		CheckedAt: now,
+	}
+
+	var matched []procInfo
+	switch {
+	case p.PIDFile != "":
+		pid, err := readPIDFile(p.PIDFile)
+		if err != nil && !os.IsNotExist(err) {
+			w.reportError(err)
+		}
+		if info, ok := procs[pid]; ok && err == nil {
+			matched = append(matched, info)
+		}
+	default:
+		for _, info := range procs {
+			if (p.Comm != "" && info.comm == p.Comm) || (p.cmdline != nil && p.cmdline.MatchString(info.cmdline)) {
+				matched = append(matched, info)
+			}
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return matched[i].pid < matched[j].pid })
+
+	// New instances after the first check are restarts
+	current := make(map[procKey]bool, len(matched))
+	for _, info := range matched {
+		key := procKey{pid: info.pid, startTime: info.startTime}
+		current[key] = true
+		if st.checked && !st.seen[key] {
+			st.restarts = append(st.restarts, now)
+		}
+		result.PIDs = append(result.PIDs, info.pid)
+		rss, err := readRSS(w.config.ProcRoot, info.pid)
+		if err == nil {
+			result.RSS += rss
+		}
+	}
+	st.seen = current
+	st.checked = true
+
+	cutoff := now.Add(-p.RestartWindow)
+	kept := st.restarts[:0]
+	for _, t := range st.restarts {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	st.restarts = kept
+	result.Restarts = len(kept)
+
+	switch {
+	case len(matched) < p.MinCount:
+		result.Status = whooktown.StatusOffline
+		result.Detail = fmt.Sprintf("%d of %d running", len(matched), p.MinCount)
+	case p.MaxRestarts > 0 && result.Restarts > p.MaxRestarts:
+		result.Status = whooktown.StatusWarning
+		result.Detail = fmt.Sprintf("%d restarts", result.Restarts)
+	case p.MaxRSS > 0 && result.RSS > p.MaxRSS:
+		result.Status = whooktown.StatusWarning
+		result.Detail = fmt.Sprintf("rss %d MiB", result.RSS>>20)
+	default:
+		result.Status = whooktown.StatusOnline
+		result.Detail = fmt.Sprintf("%d running", len(matched))
+	}
+	return result
+}
+
+// reportError forwards an error to the configured handler
+func (w *Watcher) reportError(err error) {
+	if w.config.OnError != nil {
+		w.config.OnError(err)
+	}
+}
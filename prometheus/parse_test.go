@@ -0,0 +1,152 @@
+package prometheus
+
+import (
+	"errors"
+	"math"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func parseFixture(t *testing.T, name string) []Sample {
+	t.Helper()
+	f, err := os.Open("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	samples, err := Parse(f)
+	if err != nil {
+		t.Fatalf("Parse(%s): %v", name, err)
+	}
+	return samples
+}
+
+func TestParseBasic(t *testing.T) {
+	samples := parseFixture(t, "basic.prom")
+	want := []Sample{
+		{Name: "process_cpu_seconds_total", Value: 12.47},
+		{Name: "http_requests_total", Labels: map[string]string{"method": "post", "code": "200"}, Value: 1027, Timestamp: 1395066363000},
+		{Name: "http_requests_total", Labels: map[string]string{"method": "post", "code": "400"}, Value: 3, Timestamp: 1395066363000},
+		{Name: "http_requests_total", Labels: map[string]string{}, Value: 5},
+		{Name: "node_load1", Value: 1.5e-3},
+	}
+	if !reflect.DeepEqual(samples, want) {
+		t.Errorf("got %+v\nwant %+v", samples, want)
+	}
+}
+
+func TestParseEscapes(t *testing.T) {
+	samples := parseFixture(t, "escapes.prom")
+	if len(samples) != 2 {
+		t.Fatalf("got %d samples, want 2", len(samples))
+	}
+	want := map[string]string{
+		"path":  `C:\DIR\FILE.TXT`,
+		"error": "Cannot find file:\n\"FILE.TXT\"",
+	}
+	if !reflect.DeepEqual(samples[0].Labels, want) {
+		t.Errorf("labels = %q, want %q", samples[0].Labels, want)
+	}
+	if samples[0].Value != 1.458255915e9 {
+		t.Errorf("value = %v", samples[0].Value)
+	}
+	want = map[string]string{"a": "x,y", "b": "{}", "c": "="}
+	if !reflect.DeepEqual(samples[1].Labels, want) {
+		t.Errorf("labels = %q, want %q", samples[1].Labels, want)
+	}
+}
+
+func TestParseSpecialValues(t *testing.T) {
+	samples := parseFixture(t, "special.prom")
+	values := make(map[string]float64)
+	for _, s := range samples {
+		values[s.Name+s.Labels["le"]] = s.Value
+	}
+	if v := values["http_request_duration_seconds_bucket+Inf"]; v != 144320 {
+		t.Errorf(`bucket le="+Inf" = %v, want 144320`, v)
+	}
+	if v := values["gauge_pos_inf"]; !math.IsInf(v, 1) {
+		t.Errorf("gauge_pos_inf = %v, want +Inf", v)
+	}
+	if v := values["gauge_neg_inf"]; !math.IsInf(v, -1) {
+		t.Errorf("gauge_neg_inf = %v, want -Inf", v)
+	}
+	if v := values["gauge_nan"]; !math.IsNaN(v) {
+		t.Errorf("gauge_nan = %v, want NaN", v)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, line := range []string{
+		`1metric 1`,
+		`metric`,
+		`metric 1 2 3`,
+		`metric abc`,
+		`metric 1 1.5`,
+		`metric{a="1" 1`,
+		`metric{a=1} 1`,
+		`metric{a="1} 1`,
+	} {
+		if _, err := Parse(strings.NewReader(line)); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", line)
+		}
+	}
+}
+
+func TestParseSkipsInvalidLines(t *testing.T) {
+	f, err := os.Open("testdata/invalid.prom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	samples, err := Parse(f)
+
+	want := []Sample{{Name: "up", Value: 1}, {Name: "node_load5", Value: 0.75}}
+	if !reflect.DeepEqual(samples, want) {
+		t.Errorf("got %+v\nwant %+v", samples, want)
+	}
+	var lines []int
+	for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+		var lineErr *LineError
+		if errors.As(e, &lineErr) {
+			lines = append(lines, lineErr.Line)
+		}
+	}
+	if !reflect.DeepEqual(lines, []int{3, 5}) {
+		t.Errorf("errors on lines %v, want [3 5]: %v", lines, err)
+	}
+}
+
+func TestApplyCompilesOnce(t *testing.T) {
+	samples := parseFixture(t, "basic.prom")
+	mappings := []Mapping{{Metric: "http_requests_total", Field: "activeConnections", LabelRegexp: map[string]string{"code": "2.."}}}
+	for i := 0; i < 2; i++ {
+		updates, err := Apply(mappings, samples)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(updates) != 1 || updates[0].ActiveConns != 1027 {
+			t.Fatalf("got %+v, want 1027 connections", updates)
+		}
+		if mappings[0].labelRegexp == nil {
+			t.Fatal("mapping was not compiled in place")
+		}
+	}
+}
+
+func TestEvaluateSkipsNonFinite(t *testing.T) {
+	samples := parseFixture(t, "special.prom")
+	for _, metric := range []string{"gauge_pos_inf", "gauge_neg_inf", "gauge_nan"} {
+		m := Mapping{Metric: metric, Field: "cpuUsage"}
+		if v, ok := m.Evaluate(samples); ok {
+			t.Errorf("Evaluate(%s) = %v, want no value", metric, v)
+		}
+	}
+
+	m := Mapping{Metric: "http_request_duration_seconds_bucket", Field: "cpuUsage", Aggregate: "max"}
+	if v, ok := m.Evaluate(samples); !ok || v != 144320 {
+		t.Errorf("Evaluate(bucket) = %v, %v, want 144320", v, ok)
+	}
+}
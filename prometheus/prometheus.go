@@ -0,0 +1,370 @@
+// Package prometheus scrapes Prometheus text-format endpoints and maps
+// selected series onto whooktown sensor fields.
+package prometheus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"regexp"
+	"time"
+
+	whooktown "github.com/fredericalix/whooktown-golang-sdk"
+	"github.com/gofrs/uuid"
+)
+
+// Mapping selects series by metric name and labels and writes their value to a sensor field
+type Mapping struct {
+	SensorID uuid.UUID `json:"sensor_id"`
+	Sensor   string    `json:"sensor,omitempty"` // Sensor name, used when SensorID is nil
+	Field    string    `json:"field"`            // SensorData JSON field name, e.g. "cpuUsage"
+
+	Metric      string            `json:"metric"`
+	Labels      map[string]string `json:"labels,omitempty"`       // Exact label matches
+	LabelRegexp map[string]string `json:"label_regexp,omitempty"` // Fully anchored label regexps
+
+	// Aggregate combines matching series: sum (default), avg, min, max or count
+	Aggregate string `json:"aggregate,omitempty"`
+
+	// Factor multiplies the value (e.g. 100 for a 0-1 ratio)
+	Factor float64 `json:"factor,omitempty"`
+	// Min and Max scale the value to 0-100 when both are set
+	Min *float64 `json:"min,omitempty"`
+	Max *float64 `json:"max,omitempty"`
+
+	labelRegexp map[string]*regexp.Regexp
+}
+
+// Target is a metrics endpoint and the mappings evaluated against it
+type Target struct {
+	URL      string            `json:"url"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	Mappings []Mapping         `json:"mappings"`
+}
+
+// LoadTargets reads a JSON array of targets from a file
+func LoadTargets(path string) ([]Target, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, whooktown.NewErrorWithCause(whooktown.ErrValidation, "failed to read targets", err)
+	}
+	var targets []Target
+	if err := json.Unmarshal(data, &targets); err != nil {
+		return nil, whooktown.NewErrorWithCause(whooktown.ErrValidation, "invalid targets", err)
+	}
+	return targets, nil
+}
+
+// Config configures a scraper
+type Config struct {
+	Targets []Target
+
+	// Interval between scrapes (default: 30s)
+	Interval time.Duration
+
+	// Timeout per scrape (default: 10s)
+	Timeout time.Duration
+
+	// HTTPClient performs scrapes (default: http.DefaultClient)
+	HTTPClient *http.Client
+
+	// Names resolves the Sensor names of mappings (default: a registry in
+	// whooktown.NamespaceWhooktown)
+	Names *whooktown.Registry
+
+	// OnError is called when a scrape or a send fails
+	OnError func(err error)
+}
+
+// Scraper periodically scrapes targets and publishes mapped values
+type Scraper struct {
+	sensors whooktown.SensorSender
+	config  Config
+}
+
+// New validates the configuration and creates a scraper sending to sensors
+func New(sensors whooktown.SensorSender, config Config) (*Scraper, error) {
+	if config.Interval <= 0 {
+		config.Interval = 30 * time.Second
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+	if config.Names == nil {
+		config.Names = whooktown.NewRegistry(uuid.Nil)
+	}
+
+	targets := make([]Target, len(config.Targets))
+	for i, t := range config.Targets {
+		if t.URL == "" {
+			return nil, whooktown.NewError(whooktown.ErrValidation, "target url is required")
+		}
+		t.Mappings = append([]Mapping(nil), t.Mappings...)
+		for j := range t.Mappings {
+			m := &t.Mappings[j]
+			if err := m.Compile(); err != nil {
+				return nil, err
+			}
+			if m.SensorID == uuid.Nil && m.Sensor != "" {
+				m.SensorID = config.Names.ID(m.Sensor)
+			}
+		}
+		targets[i] = t
+	}
+	config.Targets = targets
+
+	return &Scraper{
+		sensors: sensors,
+		config:  config,
+	}, nil
+}
+
+// Compile validates the mapping and compiles its label regexps.
+// New compiles the mappings of its targets; Apply compiles the others on
+// first use.
+func (m *Mapping) Compile() error {
+	if m.Metric == "" || m.Field == "" {
+		return whooktown.NewError(whooktown.ErrValidation, "mapping metric and field are required")
+	}
+	if err := whooktown.ValidateField(m.Field); err != nil {
+		return whooktown.NewErrorWithCause(whooktown.ErrValidation, fmt.Sprintf("mapping %s: invalid field", m.Metric), err)
+	}
+	switch m.Aggregate {
+	case "", "sum", "avg", "min", "max", "count":
+	default:
+		return whooktown.NewError(whooktown.ErrValidation, fmt.Sprintf("mapping %s: unknown aggregate %q", m.Metric, m.Aggregate))
+	}
+	m.labelRegexp = make(map[string]*regexp.Regexp, len(m.LabelRegexp))
+	for name, expr := range m.LabelRegexp {
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return whooktown.NewErrorWithCause(whooktown.ErrValidation, fmt.Sprintf("mapping %s: invalid label regexp", m.Metric), err)
+		}
+		m.labelRegexp[name] = re
+	}
+	return nil
+}
+
+// sensorID returns the sensor of the mapping, deriving it from Sensor in
+// whooktown.NamespaceWhooktown when SensorID is nil
+func (m *Mapping) sensorID() uuid.UUID {
+	if m.SensorID == uuid.Nil && m.Sensor != "" {
+		return whooktown.IDFromName(uuid.Nil, m.Sensor)
+	}
+	return m.SensorID
+}
+
+// matches reports whether a sample is selected by the mapping
+func (m *Mapping) matches(s *Sample) bool {
+	if s.Name != m.Metric {
+		return false
+	}
+	for name, value := range m.Labels {
+		if s.Labels[name] != value {
+			return false
+		}
+	}
+	for name, re := range m.labelRegexp {
+		if !re.MatchString(s.Labels[name]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Evaluate applies the mapping to samples and returns the resulting value.
+// Series whose value is NaN or infinite are skipped.
+func (m *Mapping) Evaluate(samples []Sample) (float64, bool) {
+	var sum, lo, hi float64
+	n := 0
+	for i := range samples {
+		s := &samples[i]
+		if !m.matches(s) || math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+			continue
+		}
+		if n == 0 || s.Value < lo {
+			lo = s.Value
+		}
+		if n == 0 || s.Value > hi {
+			hi = s.Value
+		}
+		sum += s.Value
+		n++
+	}
+	if n == 0 {
+		return 0, false
+	}
+
+	var v float64
+	switch m.Aggregate {
+	case "avg":
+		v = sum / float64(n)
+	case "min":
+		v = lo
+	case "max":
+		v = hi
+	case "count":
+		v = float64(n)
+	default:
+		v = sum
+	}
+
+	if m.Factor != 0 {
+		v *= m.Factor
+	}
+	if m.Min != nil && m.Max != nil && *m.Max > *m.Min {
+		v = (v - *m.Min) / (*m.Max - *m.Min) * 100
+		v = math.Max(0, math.Min(100, v))
+	}
+	return v, true
+}
+
+// Apply evaluates mappings against samples and returns one update per sensor.
+// Invalid mappings and values that cannot be set are skipped and their
+// errors joined. Mappings that were not compiled are compiled in place, so
+// mappings shared between goroutines must be compiled beforehand.
+func Apply(mappings []Mapping, samples []Sample) ([]*whooktown.SensorData, error) {
+	var updates []*whooktown.SensorData
+	var errs []error
+	byID := make(map[uuid.UUID]*whooktown.SensorData)
+	for i := range mappings {
+		m := &mappings[i]
+		if m.labelRegexp == nil {
+			if err := m.Compile(); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+		v, ok := m.Evaluate(samples)
+		if !ok {
+			continue
+		}
+		id := m.sensorID()
+		data, ok := byID[id]
+		if !ok {
+			data = &whooktown.SensorData{ID: id}
+			byID[id] = data
+			updates = append(updates, data)
+		}
+		if err := data.SetField(m.Field, v); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return updates, errors.Join(errs...)
+}
+
+// Scrape fetches every target and returns the mapped sensor updates.
+// Failed targets are reported to OnError and skipped.
+func (s *Scraper) Scrape(ctx context.Context) []*whooktown.SensorData {
+	updates, err := s.Collect(ctx)
+	if err != nil {
+		s.reportError(err)
+	}
+	result := make([]*whooktown.SensorData, len(updates))
+	for i := range updates {
+		result[i] = &updates[i]
+	}
+	return result
+}
+
+// Collect fetches every target and returns the mapped sensor updates.
+// Failed targets and malformed lines are skipped and their errors joined.
+func (s *Scraper) Collect(ctx context.Context) ([]whooktown.SensorData, error) {
+	var updates []whooktown.SensorData
+	var errs []error
+	for _, t := range s.config.Targets {
+		samples, err := s.fetch(ctx, t)
+		if err != nil {
+			errs = append(errs, err)
+			if samples == nil {
+				continue
+			}
+		}
+		mapped, err := Apply(t.Mappings, samples)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		for _, data := range mapped {
+			updates = append(updates, *data)
+		}
+	}
+	return updates, errors.Join(errs...)
+}
+
+// RunOnce scrapes every target and sends the updates
+func (s *Scraper) RunOnce(ctx context.Context) {
+	for _, data := range s.Scrape(ctx) {
+		if err := s.sensors.Send(ctx, data); err != nil {
+			s.reportError(err)
+		}
+	}
+}
+
+// Run scrapes every Interval until the context is cancelled
+func (s *Scraper) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+
+	s.RunOnce(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			s.RunOnce(ctx)
+		}
+	}
+}
+
+// fetch scrapes and parses a single target. Samples are returned with
+// the error when only some lines are malformed.
+func (s *Scraper) fetch(ctx context.Context, t Target) ([]Sample, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.config.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.URL, nil)
+	if err != nil {
+		return nil, whooktown.NewErrorWithCause(whooktown.ErrValidation, "invalid target url", err)
+	}
+	req.Header.Set("Accept", "text/plain;version=0.0.4")
+	for k, v := range t.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.config.HTTPClient.Do(req)
+	if err != nil {
+		return nil, whooktown.NewErrorWithCause(whooktown.ErrNetworkError, "scrape failed: "+t.URL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, &whooktown.Error{
+			Code:       whooktown.ErrNetworkError,
+			Message:    fmt.Sprintf("scrape failed: %s returned %d", t.URL, resp.StatusCode),
+			StatusCode: resp.StatusCode,
+		}
+	}
+
+	samples, err := Parse(resp.Body)
+	if err != nil {
+		var lineErr *LineError
+		if !errors.As(err, &lineErr) {
+			return nil, whooktown.NewErrorWithCause(whooktown.ErrValidation, "invalid exposition: "+t.URL, err)
+		}
+		err = whooktown.NewErrorWithCause(whooktown.ErrValidation, "skipped malformed lines: "+t.URL, err)
+	}
+	return samples, err
+}
+
+// reportError forwards an error to the configured handler
+func (s *Scraper) reportError(err error) {
+	if s.config.OnError != nil {
+		s.config.OnError(err)
+	}
+}
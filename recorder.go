@@ -0,0 +1,328 @@
+package whooktown
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// Record is a sensor update captured at a point in time
+type Record struct {
+	Time time.Time
+	Data *SensorData
+}
+
+// recordJSON is the on-disk form of a record: one JSON object per line
+// with the time in Unix milliseconds
+type recordJSON struct {
+	T    int64       `json:"t"`
+	Data *SensorData `json:"data"`
+}
+
+// MarshalJSON encodes the record as {"t": <unix ms>, "data": {...}}
+func (r Record) MarshalJSON() ([]byte, error) {
+	return json.Marshal(recordJSON{T: r.Time.UnixMilli(), Data: r.Data})
+}
+
+// UnmarshalJSON decodes a record written by MarshalJSON
+func (r *Record) UnmarshalJSON(data []byte) error {
+	var rec recordJSON
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return err
+	}
+	if rec.Data == nil {
+		return NewError(ErrValidation, "record has no data")
+	}
+	r.Time = time.UnixMilli(rec.T)
+	r.Data = rec.Data
+	return nil
+}
+
+// Recorder writes sensor updates as newline-delimited JSON records
+type Recorder struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+// NewRecorder creates a recorder writing to w
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{enc: json.NewEncoder(w)}
+}
+
+// Attach records every update sent successfully through the sensors client
+func (r *Recorder) Attach(sensors *SensorsClient) {
+	sensors.AddHook(func(data *SensorData, err error) {
+		if err == nil {
+			r.Record(data)
+		}
+	})
+}
+
+// Record writes an update with the current time
+func (r *Recorder) Record(data *SensorData) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.enc.Encode(Record{Time: time.Now(), Data: data}); err != nil {
+		r.err = err
+		return err
+	}
+	return nil
+}
+
+// Err returns the last write error, if any
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// ReadRecording reads the records written by a Recorder, sorted by time
+func ReadRecording(rd io.Reader) ([]Record, error) {
+	var records []Record
+	scanner := bufio.NewScanner(rd)
+	scanner.Buffer(make([]byte, 64*1024), 4<<20)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, NewErrorWithCause(ErrValidation, fmt.Sprintf("invalid record on line %d", line), err)
+		}
+		records = append(records, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, NewErrorWithCause(ErrValidation, "failed to read recording", err)
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Time.Before(records[j].Time)
+	})
+	return records, nil
+}
+
+// minLoopPeriod is the shortest playback time between two loops of a recording
+const minLoopPeriod = time.Second
+
+// ReplayConfig configures a replayer
+type ReplayConfig struct {
+	// Speed multiplies the playback rate, e.g. 10 plays ten times faster (default: 1)
+	Speed float64
+
+	// RemapIDs translates recorded sensor IDs, e.g. to drive another layout
+	RemapIDs map[uuid.UUID]uuid.UUID
+
+	// Loop restarts the recording when it ends, at most once per second of
+	// playback time
+	Loop bool
+
+	// OnError is called when a replayed update fails to send
+	OnError func(err error)
+}
+
+// Replayer sends recorded updates with their original timing
+type Replayer struct {
+	sensors SensorSender
+	records []Record
+	config  ReplayConfig
+
+	mu         sync.Mutex
+	next       int           // Index of the next record to send
+	anchorPos  time.Duration // Playback position at anchorWall
+	anchorWall time.Time
+	paused     bool
+	wake       chan struct{}
+}
+
+// NewReplayer creates a replayer sending records to sensors.
+// Records must be sorted by time, as returned by ReadRecording.
+func NewReplayer(sensors SensorSender, records []Record, config ReplayConfig) *Replayer {
+	if config.Speed <= 0 {
+		config.Speed = 1
+	}
+	return &Replayer{
+		sensors: sensors,
+		records: records,
+		config:  config,
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// Run replays the records until the recording ends (unless Loop is set) or
+// the context is cancelled
+func (p *Replayer) Run(ctx context.Context) error {
+	p.mu.Lock()
+	p.anchorWall = time.Now()
+	p.mu.Unlock()
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		p.mu.Lock()
+		if p.next >= len(p.records) {
+			if !p.config.Loop || len(p.records) == 0 {
+				p.mu.Unlock()
+				return nil
+			}
+			// Restart once a full loop period has played, so that a short
+			// recording does not replay in a busy loop
+			period := max(p.duration(), minLoopPeriod)
+			if p.paused || p.position() < period {
+				wait := time.Duration(-1)
+				if !p.paused {
+					wait = max(1, time.Duration(float64(period-p.position())/p.config.Speed))
+				}
+				p.mu.Unlock()
+				if err := p.sleep(ctx, timer, wait); err != nil {
+					return err
+				}
+				continue
+			}
+			p.seek(0)
+		}
+		rec := p.records[p.next]
+		wait := time.Duration(-1)
+		if !p.paused {
+			wait = time.Duration(float64(p.offset(p.next)-p.position()) / p.config.Speed)
+			if wait <= 0 {
+				p.next++
+			}
+		}
+		p.mu.Unlock()
+
+		if wait > 0 || wait == -1 {
+			if err := p.sleep(ctx, timer, wait); err != nil {
+				return err
+			}
+			continue
+		}
+
+		p.send(ctx, rec.Data)
+	}
+}
+
+// sleep waits for the delay, or until woken when it is -1 (paused)
+func (p *Replayer) sleep(ctx context.Context, timer *time.Timer, wait time.Duration) error {
+	var fire <-chan time.Time
+	if wait > 0 {
+		timer.Reset(wait)
+		fire = timer.C
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-p.wake:
+	case <-fire:
+	}
+	if fire != nil && !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+	return nil
+}
+
+// Pause stops playback at the current position
+func (p *Replayer) Pause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.paused {
+		p.anchorPos = p.position()
+		p.paused = true
+	}
+	p.signal()
+}
+
+// Resume continues playback from the current position
+func (p *Replayer) Resume() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.paused {
+		p.anchorWall = time.Now()
+		p.paused = false
+	}
+	p.signal()
+}
+
+// Seek moves playback to a position from the start of the recording
+func (p *Replayer) Seek(pos time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.seek(max(0, min(pos, p.duration())))
+	p.signal()
+}
+
+// Position returns the playback position from the start of the recording
+func (p *Replayer) Position() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.position()
+}
+
+// Duration returns the length of the recording
+func (p *Replayer) Duration() time.Duration {
+	return p.duration()
+}
+
+// seek sets the position and the next record. Callers hold p.mu.
+func (p *Replayer) seek(pos time.Duration) {
+	p.anchorPos = pos
+	p.anchorWall = time.Now()
+	p.next = sort.Search(len(p.records), func(i int) bool {
+		return p.offset(i) >= pos
+	})
+}
+
+// position returns the current playback position. Callers hold p.mu.
+func (p *Replayer) position() time.Duration {
+	if p.paused || p.anchorWall.IsZero() {
+		return p.anchorPos
+	}
+	return p.anchorPos + time.Duration(float64(time.Since(p.anchorWall))*p.config.Speed)
+}
+
+// offset returns the time of record i from the start of the recording
+func (p *Replayer) offset(i int) time.Duration {
+	return p.records[i].Time.Sub(p.records[0].Time)
+}
+
+// duration returns the length of the recording
+func (p *Replayer) duration() time.Duration {
+	if len(p.records) == 0 {
+		return 0
+	}
+	return p.offset(len(p.records) - 1)
+}
+
+// signal wakes Run to recompute its wait. Callers hold p.mu.
+func (p *Replayer) signal() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// send sends a recorded update, remapping its sensor ID
+func (p *Replayer) send(ctx context.Context, data *SensorData) {
+	d := *data
+	if id, ok := p.config.RemapIDs[d.ID]; ok {
+		d.ID = id
+	}
+	if err := p.sensors.Send(ctx, &d); err != nil && p.config.OnError != nil {
+		p.config.OnError(err)
+	}
+}
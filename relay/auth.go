@@ -0,0 +1,162 @@
+package relay
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	whooktown "github.com/fredericalix/whooktown-golang-sdk"
+)
+
+// Producer is an internal host or service allowed to send through the relay
+type Producer struct {
+	Name string `json:"name"`
+
+	// Secret is the shared secret sent as "Authorization: Bearer <secret>".
+	// Producers without a secret are identified by network only.
+	Secret string `json:"secret,omitempty"`
+
+	// Networks restricts the producer to these CIDRs, e.g. "10.0.0.0/8"
+	Networks []string `json:"networks,omitempty"`
+
+	// RateLimit is the sustained updates per second (default: Config.RateLimit, 0 disables)
+	RateLimit float64 `json:"rate_limit,omitempty"`
+	// Burst is the number of updates accepted at once (default: max(1, RateLimit))
+	Burst int `json:"burst,omitempty"`
+
+	networks []*net.IPNet
+	limiter  *limiter
+}
+
+// Validate checks the producer configuration
+func (p *Producer) Validate() error {
+	if p.Name == "" {
+		return whooktown.NewError(whooktown.ErrValidation, "relay producer name is required")
+	}
+	if p.Secret == "" && len(p.Networks) == 0 {
+		return whooktown.NewError(whooktown.ErrValidation, fmt.Sprintf("relay producer %s: secret or networks is required", p.Name))
+	}
+	for _, cidr := range p.Networks {
+		if _, err := parseNetwork(cidr); err != nil {
+			return whooktown.NewErrorWithCause(whooktown.ErrValidation, fmt.Sprintf("relay producer %s: invalid network %q", p.Name, cidr), err)
+		}
+	}
+	return nil
+}
+
+// matches reports whether a request comes from the producer
+func (p *Producer) matches(secret string, ip net.IP) bool {
+	if p.Secret != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(p.Secret)) != 1 {
+		return false
+	}
+	if len(p.networks) == 0 {
+		return true
+	}
+	if ip == nil {
+		return false
+	}
+	for _, n := range p.networks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticate returns the producer sending a request, or nil.
+// Producers with a secret take precedence over network-only producers, and
+// a request carrying a secret that no producer accepts is rejected rather
+// than identified by network.
+func (r *Relay) authenticate(req *http.Request) *Producer {
+	secret := ""
+	if auth := req.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		secret = strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	ip := remoteIP(req)
+
+	var byNetwork *Producer
+	for i := range r.config.Producers {
+		p := &r.config.Producers[i]
+		if p.Secret == "" {
+			if byNetwork == nil && p.matches("", ip) {
+				byNetwork = p
+			}
+			continue
+		}
+		if secret != "" && p.matches(secret, ip) {
+			return p
+		}
+	}
+	if secret != "" {
+		return nil
+	}
+	return byNetwork
+}
+
+// remoteIP returns the IP address of the direct peer.
+// Forwarding headers are not trusted.
+func remoteIP(req *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// parseNetwork parses a CIDR or a single IP address
+func parseNetwork(s string) (*net.IPNet, error) {
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address %q", s)
+		}
+		bits := 128
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 32
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, n, err := net.ParseCIDR(s)
+	return n, err
+}
+
+// limiter is a token bucket
+type limiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newLimiter creates a full bucket refilled at rate tokens per second
+func newLimiter(rate float64, burst int) *limiter {
+	if burst <= 0 {
+		burst = max(1, int(rate))
+	}
+	return &limiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// allow takes a token if one is available, otherwise it returns the wait until the next one
+func (l *limiter) allow() (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	if l.tokens >= 1 {
+		l.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
@@ -0,0 +1,484 @@
+// Package relay runs a local sensor endpoint for internal producers that hold
+// no whooktown token. Producers authenticate with shared secrets or by network,
+// and the relay forwards their updates upstream with a single central client.
+//
+// The sensor API takes one update per request, so the relay does not batch:
+// it coalesces the pending updates of each sensor and forwards them with
+// Workers concurrent requests, retrying failures with backoff.
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	whooktown "github.com/fredericalix/whooktown-golang-sdk"
+	"github.com/gofrs/uuid"
+)
+
+// maxPayloadSize bounds the size of an accepted sensor update
+const maxPayloadSize = 1 << 20
+
+// Config configures a relay
+type Config struct {
+	// Addr is the address to listen on (default: "127.0.0.1:8090")
+	Addr string
+
+	Producers []Producer
+
+	// RateLimit is the default per-producer updates per second (0 disables)
+	RateLimit float64
+
+	// QueueSize bounds the number of sensors with a pending update (default: 1000).
+	// Producers receive 503 when it is full.
+	QueueSize int
+
+	// Workers is the number of concurrent upstream sends (default: 4)
+	Workers int
+
+	// RetryWait is the backoff after a failed forward, doubled on each
+	// further failure up to MaxRetryWait (default: 1s and 1m)
+	RetryWait    time.Duration
+	MaxRetryWait time.Duration
+
+	// OnError is called when an update cannot be forwarded upstream
+	OnError func(err error)
+}
+
+// Relay is an http.Handler exposing the /sensors API to internal producers.
+// Updates for the same sensor are coalesced while they wait to be forwarded.
+// Failed forwards are queued again with backoff.
+type Relay struct {
+	sensors whooktown.SensorSender
+	config  Config
+	mux     *http.ServeMux
+
+	mu       sync.Mutex
+	pending  map[uuid.UUID]*entry
+	order    []uuid.UUID
+	inflight map[uuid.UUID]bool
+	ready    chan struct{}
+	stats    Stats
+}
+
+// entry is a pending update of a sensor
+type entry struct {
+	data      *whooktown.SensorData
+	attempts  int       // Failed forwards so far
+	notBefore time.Time // End of the backoff after a failure
+}
+
+// Stats are the relay counters
+type Stats struct {
+	Accepted  int // Updates accepted from producers
+	Coalesced int // Updates merged into a pending update
+	Forwarded int // Updates sent upstream
+	Failed    int // Upstream sends that failed
+	Retried   int // Failed updates queued again
+	Dropped   int // Failed updates dropped: not retryable or the queue is full
+	Rejected  int // Requests rejected by authentication, rate limits or backpressure
+	Queued    int // Sensors with a pending update
+}
+
+// New validates the configuration and creates a relay forwarding to sensors
+func New(sensors whooktown.SensorSender, config Config) (*Relay, error) {
+	if config.Addr == "" {
+		config.Addr = "127.0.0.1:8090"
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = 1000
+	}
+	if config.Workers <= 0 {
+		config.Workers = 4
+	}
+	if config.RetryWait <= 0 {
+		config.RetryWait = time.Second
+	}
+	if config.MaxRetryWait <= 0 {
+		config.MaxRetryWait = time.Minute
+	}
+	if len(config.Producers) == 0 {
+		return nil, whooktown.NewError(whooktown.ErrValidation, "relay needs at least one producer")
+	}
+
+	producers := make([]Producer, len(config.Producers))
+	names := make(map[string]bool, len(config.Producers))
+	for i, p := range config.Producers {
+		if err := p.Validate(); err != nil {
+			return nil, err
+		}
+		if names[p.Name] {
+			return nil, whooktown.NewError(whooktown.ErrValidation, fmt.Sprintf("duplicate relay producer %s", p.Name))
+		}
+		names[p.Name] = true
+		for _, cidr := range p.Networks {
+			n, _ := parseNetwork(cidr)
+			p.networks = append(p.networks, n)
+		}
+		if p.RateLimit == 0 {
+			p.RateLimit = config.RateLimit
+		}
+		if p.RateLimit > 0 {
+			p.limiter = newLimiter(p.RateLimit, p.Burst)
+		}
+		producers[i] = p
+	}
+	config.Producers = producers
+
+	r := &Relay{
+		sensors:  sensors,
+		config:   config,
+		pending:  make(map[uuid.UUID]*entry),
+		inflight: make(map[uuid.UUID]bool),
+		ready:    make(chan struct{}, 1),
+	}
+	r.mux = http.NewServeMux()
+	r.mux.HandleFunc("/sensors", r.handleSensors)
+	r.mux.HandleFunc("/sensors/_health", r.handleHealth)
+	return r, nil
+}
+
+// ServeHTTP implements http.Handler
+func (r *Relay) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mux.ServeHTTP(w, req)
+}
+
+// ListenAndServe serves producers on Addr and forwards their updates until the
+// context is cancelled. Pending updates are flushed on shutdown.
+func (r *Relay) ListenAndServe(ctx context.Context) error {
+	srv := &http.Server{
+		Addr:              r.config.Addr,
+		Handler:           r,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	forwardCtx, stopForward := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.Forward(forwardCtx)
+		close(done)
+	}()
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.ListenAndServe()
+	}()
+
+	var err error
+	select {
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		srv.Shutdown(shutdownCtx)
+		cancel()
+		err = ctx.Err()
+	case err = <-errc:
+		err = whooktown.NewErrorWithCause(whooktown.ErrNetworkError, "relay server failed", err)
+	}
+
+	// Drain what producers already handed over
+	drainCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	r.Drain(drainCtx)
+	stopForward()
+	<-done
+	return err
+}
+
+// Forward sends pending updates upstream with Workers concurrent senders until
+// the context is cancelled
+func (r *Relay) Forward(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < r.config.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				e, wait, _ := r.next()
+				if e == nil {
+					r.wait(ctx, wait)
+					continue
+				}
+				r.forward(ctx, e)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Drain sends every pending update before returning, or until the context is
+// cancelled. Failed updates are retried with backoff.
+func (r *Relay) Drain(ctx context.Context) {
+	for ctx.Err() == nil {
+		e, wait, idle := r.next()
+		if idle {
+			return
+		}
+		if e == nil {
+			r.wait(ctx, wait)
+			continue
+		}
+		r.forward(ctx, e)
+	}
+}
+
+// Enqueue queues an update for forwarding, merging it into a pending update
+// for the same sensor. It fails when the queue is full.
+func (r *Relay) Enqueue(data *whooktown.SensorData) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if prev, ok := r.pending[data.ID]; ok {
+		prev.data.Merge(data)
+		r.stats.Accepted++
+		r.stats.Coalesced++
+		return nil
+	}
+	if len(r.order) >= r.config.QueueSize {
+		return errQueueFull
+	}
+	r.pending[data.ID] = &entry{data: data}
+	r.order = append(r.order, data.ID)
+	r.stats.Accepted++
+	r.signal()
+	return nil
+}
+
+// Stats returns the relay counters
+func (r *Relay) Stats() Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats := r.stats
+	stats.Queued = len(r.order)
+	return stats
+}
+
+// errQueueFull is returned by Enqueue when the queue is full
+var errQueueFull = whooktown.NewError(whooktown.ErrOverloaded, "relay queue is full")
+
+// next pops the oldest pending update that is not backing off and whose
+// sensor has no update in flight. Otherwise it returns how long until the
+// earliest backoff ends (0 to wait for a signal), and whether nothing is
+// pending or in flight at all.
+func (r *Relay) next() (*entry, time.Duration, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	var wait time.Duration
+	for i, id := range r.order {
+		if r.inflight[id] {
+			continue
+		}
+		e := r.pending[id]
+		if d := e.notBefore.Sub(now); d > 0 {
+			if wait == 0 || d < wait {
+				wait = d
+			}
+			continue
+		}
+		r.order = append(r.order[:i], r.order[i+1:]...)
+		delete(r.pending, id)
+		r.inflight[id] = true
+		if len(r.order) > 0 {
+			// Wake another worker for the rest
+			r.signal()
+		}
+		return e, 0, false
+	}
+	return nil, wait, len(r.order) == 0 && len(r.inflight) == 0
+}
+
+// wait blocks until an update is queued, the delay elapses when positive,
+// or the context is cancelled
+func (r *Relay) wait(ctx context.Context, d time.Duration) {
+	var timeout <-chan time.Time
+	if d > 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-ctx.Done():
+	case <-r.ready:
+	case <-timeout:
+	}
+}
+
+// forward sends a single update upstream, queueing it again on failure
+func (r *Relay) forward(ctx context.Context, e *entry) {
+	id := e.data.ID
+	err := r.sensors.Send(ctx, e.data)
+
+	r.mu.Lock()
+	delete(r.inflight, id)
+	retried := false
+	if err != nil {
+		r.stats.Failed++
+		if retried = r.requeue(e, err); retried {
+			r.stats.Retried++
+		} else {
+			r.stats.Dropped++
+		}
+	} else {
+		r.stats.Forwarded++
+	}
+	if len(r.order) > 0 {
+		// Updates held back while this one was in flight can go
+		r.signal()
+	}
+	r.mu.Unlock()
+
+	if err != nil && r.config.OnError != nil {
+		msg := fmt.Sprintf("failed to forward sensor %s, dropped", id)
+		if retried {
+			msg = fmt.Sprintf("failed to forward sensor %s, retrying", id)
+		}
+		r.config.OnError(whooktown.NewErrorWithCause(whooktown.ErrNetworkError, msg, err))
+	}
+}
+
+// requeue queues a failed update again with backoff, merging it under a newer
+// pending update for the same sensor. It reports false when the update is
+// dropped. Callers hold r.mu.
+func (r *Relay) requeue(e *entry, err error) bool {
+	if !retryable(err) {
+		return false
+	}
+	e.attempts++
+	backoff := r.config.RetryWait << min(e.attempts-1, 16)
+	e.notBefore = time.Now().Add(min(backoff, r.config.MaxRetryWait))
+
+	id := e.data.ID
+	if newer, ok := r.pending[id]; ok {
+		e.data.Merge(newer.data)
+		newer.data = e.data
+		newer.attempts = e.attempts
+		newer.notBefore = e.notBefore
+		return true
+	}
+	if len(r.order) >= r.config.QueueSize {
+		return false
+	}
+	r.pending[id] = e
+	r.order = append(r.order, id)
+	return true
+}
+
+// signal wakes a waiting worker
+func (r *Relay) signal() {
+	select {
+	case r.ready <- struct{}{}:
+	default:
+	}
+}
+
+// retryable reports whether a failed forward may succeed later. Requests
+// rejected by the API, other than rate limits, are not retried.
+func retryable(err error) bool {
+	if code, ok := whooktown.GetStatusCode(err); ok && code >= 400 && code < 500 {
+		return code == http.StatusTooManyRequests
+	}
+	if code, ok := whooktown.GetErrorCode(err); ok && code == whooktown.ErrValidation {
+		return false
+	}
+	return true
+}
+
+// handleSensors accepts a SensorData JSON update from a producer
+func (r *Relay) handleSensors(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	producer := r.authenticate(req)
+	if producer == nil {
+		r.reject()
+		writeError(w, http.StatusUnauthorized, "unknown producer")
+		return
+	}
+	if producer.limiter != nil {
+		if ok, wait := producer.limiter.allow(); !ok {
+			r.reject()
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeError(w, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, req.Body, maxPayloadSize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, "payload too large")
+			return
+		}
+		writeError(w, http.StatusBadRequest, "failed to read payload")
+		return
+	}
+	var data whooktown.SensorData
+	if err := json.Unmarshal(body, &data); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid sensor data")
+		return
+	}
+	if data.ID == uuid.Nil {
+		writeError(w, http.StatusBadRequest, "sensor id is required")
+		return
+	}
+
+	if err := r.Enqueue(&data); err != nil {
+		r.reject()
+		if errors.Is(err, errQueueFull) {
+			w.Header().Set("Retry-After", "1")
+			writeError(w, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// handleHealth reports the relay counters
+func (r *Relay) handleHealth(w http.ResponseWriter, req *http.Request) {
+	stats := r.Stats()
+	w.Header().Set("Content-Type", "application/json")
+	status := http.StatusOK
+	if stats.Queued >= r.config.QueueSize {
+		status = http.StatusServiceUnavailable
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":    http.StatusText(status),
+		"queued":    stats.Queued,
+		"accepted":  stats.Accepted,
+		"coalesced": stats.Coalesced,
+		"forwarded": stats.Forwarded,
+		"failed":    stats.Failed,
+		"retried":   stats.Retried,
+		"dropped":   stats.Dropped,
+		"rejected":  stats.Rejected,
+	})
+}
+
+// reject counts a rejected request
+func (r *Relay) reject() {
+	r.mu.Lock()
+	r.stats.Rejected++
+	r.mu.Unlock()
+}
+
+// writeError writes a JSON error body like the whooktown API
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
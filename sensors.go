@@ -2,21 +2,80 @@ package whooktown
 
 import (
 	"context"
+	"encoding/json"
+	"sync"
 )
 
+// SensorSender sends sensor data. SensorsClient implements it, and filters
+// such as Hysteresis wrap it.
+type SensorSender interface {
+	Send(ctx context.Context, data *SensorData) error
+}
+
 // SensorsClient provides access to the sensor endpoint
 type SensorsClient struct {
-	http *httpClient
+	http   *httpClient
+	policy *StatusPolicy
+
+	mu    sync.RWMutex
+	hooks []SendHook
+}
+
+// SendHook is called after each Send with the data that was sent and the result
+type SendHook func(data *SensorData, err error)
+
+// AddHook registers a hook called after each Send and SendRaw.
+// SendRaw hooks receive the map decoded as SensorData.
+func (c *SensorsClient) AddHook(hook SendHook) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hooks = append(c.hooks, hook)
 }
 
-// Send sends sensor data to whooktown
+// Send sends sensor data to whooktown.
+// If a status policy is configured, it is applied to a copy of data.
 func (c *SensorsClient) Send(ctx context.Context, data *SensorData) error {
+	if c.policy != nil {
+		d := *data
+		c.policy.Apply(&d)
+		data = &d
+	}
+	err := c.post(ctx, data)
+	c.runHooks(data, err)
+	return err
+}
+
+// runHooks calls the registered hooks with the result of a send
+func (c *SensorsClient) runHooks(data *SensorData, err error) {
+	c.mu.RLock()
+	hooks := c.hooks
+	c.mu.RUnlock()
+	for _, hook := range hooks {
+		hook(data, err)
+	}
+}
+
+// post sends sensor data as-is, without policy or hooks
+func (c *SensorsClient) post(ctx context.Context, data *SensorData) error {
 	return c.http.Post(ctx, "/sensors", data, nil)
 }
 
-// SendRaw sends raw sensor data (as a map) to whooktown
+// SendRaw sends raw sensor data (as a map) to whooktown.
+// The status policy is not applied; hooks are called as for Send.
 func (c *SensorsClient) SendRaw(ctx context.Context, data map[string]interface{}) error {
-	return c.http.Post(ctx, "/sensors", data, nil)
+	err := c.http.Post(ctx, "/sensors", data, nil)
+
+	c.mu.RLock()
+	hooked := len(c.hooks) > 0
+	c.mu.RUnlock()
+	if hooked {
+		// A map that does not decode as sensor data was not a sensor update
+		var d SensorData
+		if b, merr := json.Marshal(data); merr == nil && json.Unmarshal(b, &d) == nil {
+			c.runHooks(&d, err)
+		}
+	}
+	return err
 }
 
 // SendMultiple sends multiple sensor data points
@@ -0,0 +1,89 @@
+package statsd
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Metric types
+const (
+	TypeCounter = "c"
+	TypeGauge   = "g"
+	TypeTimer   = "ms"
+	TypeHisto   = "h"
+	TypeSet     = "s"
+)
+
+// Line is a single parsed StatsD line
+type Line struct {
+	Name       string
+	Value      float64
+	Raw        string // Raw value, used by sets
+	Type       string
+	SampleRate float64 // 1 when absent
+	Relative   bool    // Gauge delta (+N or -N)
+}
+
+// ParsePacket parses the newline separated lines of a packet.
+// Malformed lines are returned as errors alongside the valid lines.
+func ParsePacket(packet []byte) ([]Line, []error) {
+	var lines []Line
+	var errs []error
+	for _, raw := range bytes.Split(packet, []byte("\n")) {
+		s := strings.TrimSpace(string(raw))
+		if s == "" {
+			continue
+		}
+		l, err := ParseLine(s)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		lines = append(lines, l)
+	}
+	return lines, errs
+}
+
+// ParseLine parses `name:value|type[|@rate][|#tags]`. Tags are ignored.
+func ParseLine(s string) (Line, error) {
+	l := Line{SampleRate: 1}
+	name, rest, ok := strings.Cut(s, ":")
+	if !ok || name == "" {
+		return l, fmt.Errorf("statsd: invalid line %q", s)
+	}
+	l.Name = name
+
+	parts := strings.Split(rest, "|")
+	if len(parts) < 2 {
+		return l, fmt.Errorf("statsd: missing type in %q", s)
+	}
+	l.Raw = parts[0]
+	l.Type = parts[1]
+	switch l.Type {
+	case TypeCounter, TypeGauge, TypeTimer, TypeHisto, TypeSet:
+	default:
+		return l, fmt.Errorf("statsd: unknown type %q in %q", l.Type, s)
+	}
+
+	if l.Type != TypeSet {
+		v, err := strconv.ParseFloat(l.Raw, 64)
+		if err != nil {
+			return l, fmt.Errorf("statsd: invalid value in %q", s)
+		}
+		l.Value = v
+		l.Relative = l.Type == TypeGauge && (l.Raw[0] == '+' || l.Raw[0] == '-')
+	}
+
+	for _, p := range parts[2:] {
+		if strings.HasPrefix(p, "@") {
+			rate, err := strconv.ParseFloat(p[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return l, fmt.Errorf("statsd: invalid sample rate in %q", s)
+			}
+			l.SampleRate = rate
+		}
+	}
+	return l, nil
+}
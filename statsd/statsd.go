@@ -0,0 +1,409 @@
+// Package statsd listens for StatsD metrics over UDP, aggregates them over a
+// flush window and maps the aggregates onto whooktown sensor fields.
+package statsd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"path"
+	"sync"
+	"time"
+
+	whooktown "github.com/fredericalix/whooktown-golang-sdk"
+	"github.com/gofrs/uuid"
+)
+
+// Statistics computed per flush window
+const (
+	StatRate  = "rate"  // Counter: events per second
+	StatCount = "count" // Counter: events; timer: samples; set: unique values
+	StatValue = "value" // Gauge: current value
+	StatMean  = "mean"  // Timer: mean
+	StatMin   = "min"   // Timer: minimum
+	StatMax   = "max"   // Timer: maximum
+)
+
+// Mapping maps the aggregate of one or more metrics onto a sensor field
+type Mapping struct {
+	// Metric is a metric name or a path.Match glob such as "api.*.requests".
+	// Values of all matching metrics are summed.
+	Metric   string    `json:"metric"`
+	SensorID uuid.UUID `json:"sensor_id"`
+
+	// Stat selects the statistic (default: rate for counters, value for
+	// gauges, mean for timers, count for sets)
+	Stat string `json:"stat,omitempty"`
+
+	// Field is the SensorData JSON field name receiving the value. The
+	// "activity" field maps the value to slow/normal/fast using Slow and Fast.
+	Field string `json:"field,omitempty"`
+	// Band, if set, sends the value as a MonitorTube band of that name
+	Band string `json:"band,omitempty"`
+
+	// Slow and Fast bound the activity bands: below Slow is slow, at or above
+	// Fast is fast. Fast 0 never reports fast.
+	Slow float64 `json:"slow,omitempty"`
+	Fast float64 `json:"fast,omitempty"`
+
+	// Factor multiplies the value; Min and Max scale it to 0-100 when both are set
+	Factor float64  `json:"factor,omitempty"`
+	Min    *float64 `json:"min,omitempty"`
+	Max    *float64 `json:"max,omitempty"`
+}
+
+// Config configures a listener
+type Config struct {
+	// Addr is the UDP address to listen on (default: ":8125")
+	Addr string
+
+	// FlushInterval is the aggregation window (default: 10s)
+	FlushInterval time.Duration
+
+	Mappings []Mapping
+
+	// IdleFlushes is the number of flushes without samples after which a
+	// metric is forgotten and stops reporting zero rates (default: 6)
+	IdleFlushes int
+
+	// OnError is called for malformed lines and failed sends
+	OnError func(err error)
+}
+
+// Listener aggregates StatsD metrics and publishes mapped updates on every flush
+type Listener struct {
+	sensors whooktown.SensorSender
+	config  Config
+
+	mu          sync.Mutex
+	metrics     map[string]*aggregate
+	windowStart time.Time
+}
+
+// aggregate holds the state of one metric within a flush window.
+// Gauges keep their value across windows; everything else is reset.
+type aggregate struct {
+	typ     string
+	counter float64
+	gauge   float64
+	count   int
+	sum     float64
+	min     float64
+	max     float64
+	set     map[string]struct{}
+	seen    bool // received samples this window
+	idle    int  // consecutive windows without samples
+}
+
+// New validates the mappings and creates a listener sending to sensors
+func New(sensors whooktown.SensorSender, config Config) (*Listener, error) {
+	if config.Addr == "" {
+		config.Addr = ":8125"
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = 10 * time.Second
+	}
+	if config.IdleFlushes <= 0 {
+		config.IdleFlushes = 6
+	}
+	for _, m := range config.Mappings {
+		if _, err := path.Match(m.Metric, ""); err != nil || m.Metric == "" {
+			return nil, whooktown.NewError(whooktown.ErrValidation, fmt.Sprintf("statsd mapping: invalid metric %q", m.Metric))
+		}
+		if m.Field == "" && m.Band == "" {
+			return nil, whooktown.NewError(whooktown.ErrValidation, fmt.Sprintf("statsd mapping %s: field or band is required", m.Metric))
+		}
+		switch m.Field {
+		case "":
+		case "activity":
+			if m.Fast > 0 && m.Fast <= m.Slow {
+				return nil, whooktown.NewError(whooktown.ErrValidation, fmt.Sprintf("statsd mapping %s: fast must be above slow", m.Metric))
+			}
+		default:
+			if err := whooktown.ValidateField(m.Field); err != nil {
+				return nil, whooktown.NewErrorWithCause(whooktown.ErrValidation, fmt.Sprintf("statsd mapping %s: invalid field", m.Metric), err)
+			}
+		}
+		switch m.Stat {
+		case "", StatRate, StatCount, StatValue, StatMean, StatMin, StatMax:
+		default:
+			return nil, whooktown.NewError(whooktown.ErrValidation, fmt.Sprintf("statsd mapping %s: unknown stat %q", m.Metric, m.Stat))
+		}
+	}
+	return &Listener{
+		sensors:     sensors,
+		config:      config,
+		metrics:     make(map[string]*aggregate),
+		windowStart: time.Now(),
+	}, nil
+}
+
+// ListenAndServe listens on Addr and serves until the context is cancelled
+func (l *Listener) ListenAndServe(ctx context.Context) error {
+	conn, err := net.ListenPacket("udp", l.config.Addr)
+	if err != nil {
+		return whooktown.NewErrorWithCause(whooktown.ErrNetworkError, "failed to listen", err)
+	}
+	return l.Serve(ctx, conn)
+}
+
+// Serve reads packets from conn and flushes every FlushInterval until the
+// context is cancelled. conn is closed on return.
+func (l *Listener) Serve(ctx context.Context, conn net.PacketConn) error {
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	go func() {
+		ticker := time.NewTicker(l.config.FlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				l.Flush(ctx)
+			}
+		}
+	}()
+
+	buf := make([]byte, 65535)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			l.reportError(err)
+			continue
+		}
+		l.Ingest(buf[:n])
+	}
+}
+
+// Ingest parses and aggregates a packet. Metrics that no mapping selects
+// are ignored.
+func (l *Listener) Ingest(packet []byte) {
+	lines, errs := ParsePacket(packet)
+	for _, err := range errs {
+		l.reportError(err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, line := range lines {
+		a, ok := l.metrics[line.Name]
+		if !ok && !l.mapped(line.Name) {
+			continue
+		}
+		if !ok || a.typ != line.Type {
+			a = &aggregate{typ: line.Type}
+			l.metrics[line.Name] = a
+		}
+		a.seen = true
+		switch line.Type {
+		case TypeCounter:
+			a.counter += line.Value / line.SampleRate
+		case TypeGauge:
+			if line.Relative {
+				a.gauge += line.Value
+			} else {
+				a.gauge = line.Value
+			}
+		case TypeTimer, TypeHisto:
+			if a.count == 0 || line.Value < a.min {
+				a.min = line.Value
+			}
+			if a.count == 0 || line.Value > a.max {
+				a.max = line.Value
+			}
+			a.sum += line.Value
+			a.count++
+		case TypeSet:
+			if a.set == nil {
+				a.set = make(map[string]struct{})
+			}
+			a.set[line.Raw] = struct{}{}
+		}
+	}
+}
+
+// Flush computes the window aggregates, resets them and sends the mapped updates
+func (l *Listener) Flush(ctx context.Context) {
+	for _, data := range l.Snapshot() {
+		if err := l.sensors.Send(ctx, data); err != nil {
+			l.reportError(err)
+		}
+	}
+}
+
+// Snapshot closes the current window and returns the mapped sensor updates
+// without sending them
+func (l *Listener) Snapshot() []*whooktown.SensorData {
+	l.mu.Lock()
+	now := time.Now()
+	elapsed := now.Sub(l.windowStart).Seconds()
+	l.windowStart = now
+
+	type matched struct {
+		value float64
+		ok    bool
+	}
+	values := make([]matched, len(l.config.Mappings))
+	for i, m := range l.config.Mappings {
+		for name, a := range l.metrics {
+			if ok, _ := path.Match(m.Metric, name); !ok {
+				continue
+			}
+			v, ok := a.stat(m.Stat, elapsed)
+			if !ok {
+				continue
+			}
+			values[i].value += v
+			values[i].ok = true
+		}
+	}
+	for name, a := range l.metrics {
+		if a.seen {
+			a.idle = 0
+		} else if a.idle++; a.idle >= l.config.IdleFlushes {
+			delete(l.metrics, name)
+			continue
+		}
+		a.reset()
+	}
+	l.mu.Unlock()
+
+	var updates []*whooktown.SensorData
+	byID := make(map[uuid.UUID]*whooktown.SensorData)
+	for i, m := range l.config.Mappings {
+		if !values[i].ok {
+			continue
+		}
+		data, ok := byID[m.SensorID]
+		if !ok {
+			data = &whooktown.SensorData{ID: m.SensorID}
+			byID[m.SensorID] = data
+			updates = append(updates, data)
+		}
+		if err := m.apply(data, values[i].value); err != nil {
+			l.reportError(err)
+		}
+	}
+	return updates
+}
+
+// mapped reports whether a mapping selects the metric name
+func (l *Listener) mapped(name string) bool {
+	for _, m := range l.config.Mappings {
+		if ok, _ := path.Match(m.Metric, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// apply writes a value to the mapped field or band
+func (m *Mapping) apply(data *whooktown.SensorData, v float64) error {
+	if m.Factor != 0 {
+		v *= m.Factor
+	}
+	if m.Min != nil && m.Max != nil && *m.Max > *m.Min {
+		v = math.Max(0, math.Min(100, (v-*m.Min)/(*m.Max-*m.Min)*100))
+	}
+
+	switch m.Field {
+	case "":
+	case "activity":
+		switch {
+		case m.Fast > 0 && v >= m.Fast:
+			data.Activity = whooktown.ActivityFast
+		case v < m.Slow:
+			data.Activity = whooktown.ActivitySlow
+		default:
+			data.Activity = whooktown.ActivityNormal
+		}
+	default:
+		if err := data.SetField(m.Field, v); err != nil {
+			return err
+		}
+	}
+
+	if m.Band != "" {
+		data.Bands = append(data.Bands, whooktown.Band{Name: m.Band, Value: int(math.Round(math.Max(0, math.Min(100, v))))})
+		data.BandCount = len(data.Bands)
+	}
+	return nil
+}
+
+// stat returns a statistic of the window. Metrics that were seen before
+// report zero counts and rates in quiet windows, until they are forgotten
+// after IdleFlushes windows.
+func (a *aggregate) stat(stat string, elapsed float64) (float64, bool) {
+	switch a.typ {
+	case TypeCounter:
+		switch stat {
+		case StatCount:
+			return a.counter, true
+		case "", StatRate:
+			if elapsed <= 0 {
+				return 0, true
+			}
+			return a.counter / elapsed, true
+		}
+	case TypeGauge:
+		if stat == "" || stat == StatValue {
+			return a.gauge, true
+		}
+	case TypeTimer, TypeHisto:
+		switch stat {
+		case StatCount:
+			return float64(a.count), true
+		case StatRate:
+			if elapsed <= 0 {
+				return 0, true
+			}
+			return float64(a.count) / elapsed, true
+		}
+		if a.count == 0 {
+			return 0, false
+		}
+		switch stat {
+		case "", StatMean:
+			return a.sum / float64(a.count), true
+		case StatMin:
+			return a.min, true
+		case StatMax:
+			return a.max, true
+		}
+	case TypeSet:
+		if stat == "" || stat == StatCount {
+			return float64(len(a.set)), true
+		}
+	}
+	return 0, false
+}
+
+// reset clears the window state, keeping gauge values
+func (a *aggregate) reset() {
+	a.counter = 0
+	a.count = 0
+	a.sum = 0
+	a.min = 0
+	a.max = 0
+	a.set = nil
+	a.seen = false
+}
+
+// reportError forwards an error to the configured handler
+func (l *Listener) reportError(err error) {
+	if l.config.OnError != nil {
+		l.config.OnError(err)
+	}
+}
@@ -0,0 +1,444 @@
+package whooktown
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"maps"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// Ticker overflow modes
+const (
+	OverflowTruncate = "truncate" // Cut text to MaxLength
+	OverflowChunk    = "chunk"    // Show text in MaxLength pieces, one per frame
+)
+
+// tickerFields are the SensorData text fields a ticker can drive
+var tickerFields = map[string]bool{
+	"towerText":  true,
+	"towerBText": true,
+	"signText":   true,
+	"text1":      true,
+	"text2":      true,
+	"text3":      true,
+}
+
+// TickerConfig configures a text ticker for one display of a building
+type TickerConfig struct {
+	SensorID uuid.UUID
+
+	// Field is the text field driven: towerText (default), towerBText,
+	// signText or text1-text3
+	Field string
+
+	// MaxLength is the display length in characters (0: unlimited)
+	MaxLength int
+
+	// Overflow is truncate (default) or chunk
+	Overflow string
+
+	// Duration is how long a frame is shown unless the message sets its own (default: 5s)
+	Duration time.Duration
+
+	// Idle is shown when no message is queued; empty leaves the display as is
+	Idle string
+
+	// OnError is called when an update fails to send or a template fails
+	OnError func(err error)
+}
+
+// TickerMessage is a message rotated on a display
+type TickerMessage struct {
+	// ID identifies the message; pushing a message with the same ID replaces it
+	ID string
+
+	// Text is a text/template rendered with the ticker values, e.g. "{{.errors}} errors"
+	Text string
+
+	// Duration overrides the frame duration of the ticker
+	Duration time.Duration
+
+	// Priority: only messages of the highest queued priority rotate;
+	// lower ones resume when those expire or are removed
+	Priority int
+
+	// TTL removes the message after this duration (0 keeps it)
+	TTL time.Duration
+
+	// Once removes the message after it has been shown
+	Once bool
+}
+
+// tickerEntry is a queued message
+type tickerEntry struct {
+	TickerMessage
+	tmpl      *template.Template
+	keys      []string // Values read by tmpl
+	expiresAt time.Time
+	shown     uint64 // Rotation sequence when last shown
+}
+
+// TextTicker rotates messages on a building text display
+type TextTicker struct {
+	sensors SensorSender
+	config  TickerConfig
+
+	mu       sync.Mutex
+	messages []*tickerEntry
+	values   map[string]interface{}
+	frames   []string
+	frameDur time.Duration
+	current  *tickerEntry // Message whose frames are being shown
+	seq      uint64
+	last     string
+	wake     chan struct{}
+}
+
+// NewTextTicker validates the configuration and creates a ticker sending to sensors
+func NewTextTicker(sensors SensorSender, config TickerConfig) (*TextTicker, error) {
+	if config.Field == "" {
+		config.Field = "towerText"
+	}
+	if !tickerFields[config.Field] {
+		return nil, NewError(ErrValidation, fmt.Sprintf("ticker field must be a text field, got %q", config.Field))
+	}
+	switch config.Overflow {
+	case "":
+		config.Overflow = OverflowTruncate
+	case OverflowTruncate, OverflowChunk:
+	default:
+		return nil, NewError(ErrValidation, fmt.Sprintf("unknown ticker overflow %q", config.Overflow))
+	}
+	if config.Duration <= 0 {
+		config.Duration = 5 * time.Second
+	}
+	return &TextTicker{
+		sensors: sensors,
+		config:  config,
+		values:  make(map[string]interface{}),
+		wake:    make(chan struct{}, 1),
+	}, nil
+}
+
+// Push queues a message, replacing any message with the same ID
+func (t *TextTicker) Push(msg TickerMessage) error {
+	tmpl, err := template.New(msg.ID).Option("missingkey=zero").Parse(msg.Text)
+	if err != nil {
+		return NewErrorWithCause(ErrValidation, fmt.Sprintf("invalid ticker template %q", msg.Text), err)
+	}
+	entry := &tickerEntry{TickerMessage: msg, tmpl: tmpl, keys: templateKeys(tmpl)}
+	if msg.TTL > 0 {
+		entry.expiresAt = time.Now().Add(msg.TTL)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	preempt := len(t.messages) == 0 || msg.Priority > t.topPriority()
+	replaced := false
+	if msg.ID != "" {
+		for i, m := range t.messages {
+			if m.ID == msg.ID {
+				entry.shown = m.shown
+				if t.current == m {
+					// Redraw the shown message with its new content
+					entry.shown = 0
+					preempt = true
+				}
+				t.messages[i] = entry
+				replaced = true
+				break
+			}
+		}
+	}
+	if !replaced {
+		t.messages = append(t.messages, entry)
+	}
+	if preempt {
+		// Show a more urgent message right away
+		t.frames = nil
+		t.signal()
+	}
+	return nil
+}
+
+// Remove removes a message by ID, taking it off the display if it is shown
+func (t *TextTicker) Remove(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, m := range t.messages {
+		if m.ID == id {
+			t.messages = append(t.messages[:i], t.messages[i+1:]...)
+			break
+		}
+	}
+	if t.current != nil && t.current.ID == id {
+		t.frames = nil
+		t.current = nil
+		t.signal()
+	}
+}
+
+// SetValue sets a template value
+func (t *TextTicker) SetValue(key string, value interface{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.values[key] = value
+}
+
+// Next advances the rotation and returns the next frame and how long to show it.
+// It returns false when no message is queued.
+func (t *TextTicker) Next() (string, time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.frames) == 0 {
+		t.load()
+	}
+	if len(t.frames) == 0 {
+		t.current = nil
+		return "", t.config.Duration, false
+	}
+	frame := t.frames[0]
+	t.frames = t.frames[1:]
+	return frame, t.frameDur, true
+}
+
+// Run shows frames until the context is cancelled
+func (t *TextTicker) Run(ctx context.Context) error {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	<-timer.C
+	// Messages pushed before Run are shown in order
+	select {
+	case <-t.wake:
+	default:
+	}
+
+	for {
+		text, d, ok := t.Next()
+		if !ok {
+			text = t.config.Idle
+		}
+		if ok || text != "" {
+			t.show(ctx, text)
+		}
+
+		timer.Reset(d)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.wake:
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+		case <-timer.C:
+		}
+	}
+}
+
+// show sends a frame if it differs from the one displayed
+func (t *TextTicker) show(ctx context.Context, text string) {
+	t.mu.Lock()
+	if text == t.last {
+		t.mu.Unlock()
+		return
+	}
+	t.mu.Unlock()
+
+	data := &SensorData{ID: t.config.SensorID}
+	data.SetField(t.config.Field, text)
+	if err := t.sensors.Send(ctx, data); err != nil {
+		t.reportError(err)
+		return
+	}
+	t.mu.Lock()
+	t.last = text
+	t.mu.Unlock()
+}
+
+// load renders the next message into frames. Callers hold t.mu.
+func (t *TextTicker) load() {
+	now := time.Now()
+	kept := t.messages[:0]
+	for _, m := range t.messages {
+		if m.expiresAt.IsZero() || now.Before(m.expiresAt) {
+			kept = append(kept, m)
+		}
+	}
+	t.messages = kept
+	if len(t.messages) == 0 {
+		return
+	}
+
+	// Round robin within the highest priority
+	top := t.topPriority()
+	var next *tickerEntry
+	for _, m := range t.messages {
+		if m.Priority == top && (next == nil || m.shown < next.shown) {
+			next = m
+		}
+	}
+	t.seq++
+	next.shown = t.seq
+	if next.Once {
+		for i, m := range t.messages {
+			if m == next {
+				t.messages = append(t.messages[:i], t.messages[i+1:]...)
+				break
+			}
+		}
+	}
+
+	// Missing values render as empty rather than "<no value>"
+	values := t.values
+	for _, key := range next.keys {
+		if _, ok := values[key]; ok {
+			continue
+		}
+		if len(values) == len(t.values) {
+			values = maps.Clone(t.values)
+		}
+		values[key] = ""
+	}
+
+	var buf bytes.Buffer
+	if err := next.tmpl.Execute(&buf, values); err != nil {
+		t.reportError(NewErrorWithCause(ErrValidation, fmt.Sprintf("ticker template %q failed", next.Text), err))
+		return
+	}
+	t.frames = fitText(buf.String(), t.config.MaxLength, t.config.Overflow)
+	t.current = next
+	t.frameDur = next.Duration
+	if t.frameDur <= 0 {
+		t.frameDur = t.config.Duration
+	}
+}
+
+// templateKeys returns the values printed by a template, i.e. the fields
+// such as {{.errors}} of its actions. The pipelines of if, range and with
+// are left out: range cannot iterate over the empty string they would get.
+func templateKeys(tmpl *template.Template) []string {
+	seen := make(map[string]bool)
+	var walk func(node parse.Node, printed bool)
+	walk = func(node parse.Node, printed bool) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n != nil {
+				for _, child := range n.Nodes {
+					walk(child, false)
+				}
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe, true)
+		case *parse.PipeNode:
+			for _, cmd := range n.Cmds {
+				for _, arg := range cmd.Args {
+					walk(arg, printed)
+				}
+			}
+		case *parse.FieldNode:
+			if printed && len(n.Ident) == 1 {
+				seen[n.Ident[0]] = true
+			}
+		case *parse.IfNode:
+			walk(n.List, false)
+			walk(n.ElseList, false)
+		case *parse.RangeNode:
+			walk(n.List, false)
+			walk(n.ElseList, false)
+		case *parse.WithNode:
+			walk(n.List, false)
+			walk(n.ElseList, false)
+		}
+	}
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			walk(t.Tree.Root, false)
+		}
+	}
+
+	keys := make([]string, 0, len(seen))
+	for key := range seen {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// topPriority returns the highest queued priority. Callers hold t.mu.
+func (t *TextTicker) topPriority() int {
+	top := 0
+	for i, m := range t.messages {
+		if i == 0 || m.Priority > top {
+			top = m.Priority
+		}
+	}
+	return top
+}
+
+// signal wakes Run to show a new message. Callers hold t.mu.
+func (t *TextTicker) signal() {
+	select {
+	case t.wake <- struct{}{}:
+	default:
+	}
+}
+
+// reportError forwards an error to the configured handler
+func (t *TextTicker) reportError(err error) {
+	if t.config.OnError != nil {
+		t.config.OnError(err)
+	}
+}
+
+// fitText fits text to a display length, truncating it or splitting it on
+// word boundaries into frames
+func fitText(text string, maxLen int, overflow string) []string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if maxLen <= 0 || len(runes) <= maxLen {
+		return []string{text}
+	}
+	if overflow != OverflowChunk {
+		return []string{string(runes[:maxLen])}
+	}
+
+	var frames []string
+	var line []rune
+	for _, word := range strings.Fields(text) {
+		w := []rune(word)
+		for len(w) > maxLen {
+			if len(line) > 0 {
+				frames = append(frames, string(line))
+				line = nil
+			}
+			frames = append(frames, string(w[:maxLen]))
+			w = w[maxLen:]
+		}
+		switch {
+		case len(w) == 0:
+		case len(line) == 0:
+			line = w
+		case len(line)+1+len(w) <= maxLen:
+			line = append(append(line, ' '), w...)
+		default:
+			frames = append(frames, string(line))
+			line = w
+		}
+	}
+	if len(line) > 0 {
+		frames = append(frames, string(line))
+	}
+	return frames
+}
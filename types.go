@@ -1,7 +1,14 @@
 package whooktown
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofrs/uuid"
@@ -26,6 +33,14 @@ const (
 	ActivityFast   Activity = "fast"
 )
 
+// Quantity levels shown by a Bank building
+const (
+	QuantityNone   = "none"
+	QuantityLow    = "low"
+	QuantityMedium = "medium"
+	QuantityFull   = "full"
+)
+
 // Speed represents traffic speed levels
 type Speed string
 
@@ -162,7 +177,8 @@ type Band struct {
 	Value int    `json:"value"`
 }
 
-// MarshalJSON implements custom JSON marshaling to flatten Extra fields
+// MarshalJSON implements custom JSON marshaling to flatten Extra fields.
+// Extra keys that collide with a populated field are ignored.
 func (s *SensorData) MarshalJSON() ([]byte, error) {
 	type Alias SensorData
 	data, err := json.Marshal((*Alias)(s))
@@ -174,17 +190,303 @@ func (s *SensorData) MarshalJSON() ([]byte, error) {
 		return data, nil
 	}
 
-	// Merge Extra fields into the JSON
-	var m map[string]interface{}
-	if err := json.Unmarshal(data, &m); err != nil {
-		return nil, err
+	v := reflect.ValueOf(s).Elem()
+	keys := make([]string, 0, len(s.Extra))
+	for k := range s.Extra {
+		if i, ok := sensorDataFields[k]; ok && !isEmptyValue(v.Field(i)) {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	if len(keys) == 0 {
+		return data, nil
+	}
+	sort.Strings(keys)
+
+	// Splice Extra fields into the object; "id" is never omitted so the
+	// object always has at least one member before them
+	buf := bytes.NewBuffer(make([]byte, 0, len(data)+32*len(keys)))
+	buf.Write(data[:len(data)-1])
+	for _, k := range keys {
+		key, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		val, err := json.Marshal(s.Extra[k])
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteByte(',')
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(val)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON implements custom JSON unmarshaling, collecting unknown keys into Extra
+func (s *SensorData) UnmarshalJSON(data []byte) error {
+	return s.unmarshal(data, false)
+}
+
+// UnmarshalSensorDataStrict decodes a sensor payload and rejects keys that
+// do not map to a SensorData field instead of collecting them into Extra
+func UnmarshalSensorDataStrict(data []byte, s *SensorData) error {
+	return s.unmarshal(data, true)
+}
+
+// unmarshal decodes data into s, handling unknown keys according to strict
+func (s *SensorData) unmarshal(data []byte, strict bool) error {
+	// null is a no-op, as for any other JSON object
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		return nil
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	type Alias SensorData
+	var alias Alias
+	if err := json.Unmarshal(data, &alias); err != nil {
+		return err
+	}
+
+	// Keys are sorted so that strict mode always reports the same one
+	keys := make([]string, 0, len(raw))
+	for k := range raw {
+		if !isSensorDataField(k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var extra map[string]interface{}
+	for _, k := range keys {
+		if strict {
+			return &Error{
+				Code:    ErrValidation,
+				Message: fmt.Sprintf("unknown sensor field: %s", k),
+			}
+		}
+		var value interface{}
+		if err := json.Unmarshal(raw[k], &value); err != nil {
+			return err
+		}
+		if extra == nil {
+			extra = make(map[string]interface{})
+		}
+		extra[k] = value
+	}
+
+	*s = SensorData(alias)
+	s.Extra = extra
+	return nil
+}
+
+// ValidateField checks that name is a SensorData field SetField sets
+// directly, so that a mistyped name is not sent as an Extra key
+func ValidateField(name string) error {
+	if _, ok := sensorDataFields[name]; !ok {
+		return NewError(ErrValidation, fmt.Sprintf("unknown sensor field: %s", name))
+	}
+	if name == "id" || name == "bands" {
+		return NewError(ErrValidation, fmt.Sprintf("field %s cannot be set by name", name))
+	}
+	return nil
+}
+
+// SetField sets a field by its JSON name (e.g. "cpuUsage" or "towerText").
+// Numbers are rounded for integer fields and formatted for text fields.
+// Names that are not SensorData fields are stored in Extra.
+// nil and non-finite numbers are rejected.
+func (s *SensorData) SetField(name string, value interface{}) error {
+	if value == nil {
+		return NewError(ErrValidation, fmt.Sprintf("invalid value for %s: nil", name))
+	}
+	if n, ok := toFloat(value); ok && (math.IsNaN(n) || math.IsInf(n, 0)) {
+		return NewError(ErrValidation, fmt.Sprintf("invalid value for %s: %v", name, value))
+	}
+
+	i, ok := sensorDataFields[name]
+	if !ok || name == "id" || name == "bands" {
+		if ok {
+			return NewError(ErrValidation, fmt.Sprintf("field %s cannot be set by name", name))
+		}
+		if s.Extra == nil {
+			s.Extra = make(map[string]interface{})
+		}
+		s.Extra[name] = value
+		return nil
+	}
+
+	f := reflect.ValueOf(s).Elem().Field(i)
+	switch f.Kind() {
+	case reflect.Int:
+		if n, ok := toFloat(value); ok {
+			f.SetInt(int64(math.Round(n)))
+			return nil
+		}
+		if str, ok := value.(string); ok {
+			if n, err := strconv.ParseFloat(strings.TrimSpace(str), 64); err == nil {
+				f.SetInt(int64(math.Round(n)))
+				return nil
+			}
+		}
+	case reflect.String:
+		switch v := value.(type) {
+		case string:
+			f.SetString(v)
+		case Status:
+			f.SetString(string(v))
+		case Activity:
+			f.SetString(string(v))
+		case fmt.Stringer:
+			f.SetString(v.String())
+		default:
+			if n, ok := toFloat(value); ok {
+				f.SetString(strconv.FormatFloat(n, 'f', -1, 64))
+			} else {
+				f.SetString(fmt.Sprint(value))
+			}
+		}
+		return nil
+	case reflect.Pointer:
+		var b bool
+		switch v := value.(type) {
+		case bool:
+			b = v
+		case string:
+			parsed, err := strconv.ParseBool(v)
+			if err != nil {
+				return NewErrorWithCause(ErrValidation, fmt.Sprintf("invalid value for %s", name), err)
+			}
+			b = parsed
+		default:
+			n, ok := toFloat(value)
+			if !ok {
+				return NewError(ErrValidation, fmt.Sprintf("invalid value for %s: %v", name, value))
+			}
+			b = n != 0
+		}
+		f.Set(reflect.ValueOf(&b))
+		return nil
+	}
+	return NewError(ErrValidation, fmt.Sprintf("invalid value for %s: %v", name, value))
+}
+
+// Clone returns a deep copy of s, so that the copy can be used in the
+// background while the caller reuses s. Extra maps and slices decoded from
+// JSON are copied; other Extra values are shared.
+func (s *SensorData) Clone() *SensorData {
+	c := *s
+	v := reflect.ValueOf(&c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		switch {
+		case f.Kind() == reflect.Pointer && !f.IsNil():
+			p := reflect.New(f.Type().Elem())
+			p.Elem().Set(f.Elem())
+			f.Set(p)
+		case f.Kind() == reflect.Slice && !f.IsNil():
+			f.Set(reflect.AppendSlice(reflect.MakeSlice(f.Type(), 0, f.Len()), f))
+		}
 	}
-	for k, v := range s.Extra {
-		if _, exists := m[k]; !exists {
-			m[k] = v
+	if s.Extra != nil {
+		c.Extra = cloneValue(s.Extra).(map[string]interface{})
+	}
+	return &c
+}
+
+// cloneValue deep copies the maps and slices of a decoded JSON value
+func cloneValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			c[k] = cloneValue(e)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, e := range v {
+			c[i] = cloneValue(e)
 		}
+		return c
 	}
-	return json.Marshal(m)
+	return v
+}
+
+// Merge overlays the fields set in next onto s, as the API applies a later
+// update of the same sensor: fields left empty in next keep their value in s,
+// and Extra keys of both are kept, next winning on conflicts
+func (s *SensorData) Merge(next *SensorData) {
+	dst := reflect.ValueOf(s).Elem()
+	src := reflect.ValueOf(next).Elem()
+	for _, i := range sensorDataFields {
+		if f := src.Field(i); !isEmptyValue(f) {
+			dst.Field(i).Set(f)
+		}
+	}
+	if len(next.Extra) > 0 {
+		extra := make(map[string]interface{}, len(s.Extra)+len(next.Extra))
+		for k, v := range s.Extra {
+			extra[k] = v
+		}
+		for k, v := range next.Extra {
+			extra[k] = v
+		}
+		s.Extra = extra
+	}
+}
+
+// sensorDataFields maps JSON keys to SensorData field indexes
+var sensorDataFields = func() map[string]int {
+	fields := make(map[string]int)
+	t := reflect.TypeOf(SensorData{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		fields[name] = i
+	}
+	return fields
+}()
+
+// isSensorDataField reports whether key is decoded into a SensorData field.
+// Like encoding/json, keys are matched case-insensitively.
+func isSensorDataField(key string) bool {
+	if _, ok := sensorDataFields[key]; ok {
+		return true
+	}
+	for name := range sensorDataFields {
+		if strings.EqualFold(name, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// isEmptyValue reports whether v would be dropped by an omitempty tag
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Pointer:
+		return v.IsNil()
+	}
+	return false
 }
 
 // Layout represents a city layout
@@ -207,6 +509,22 @@ type LayoutDB struct {
 	ArchiveReason string          `json:"archive_reason,omitempty"`
 }
 
+// Decode decodes the layout stored in Data.
+// The layout ID defaults to LayoutID when the data has none.
+func (l *LayoutDB) Decode() (*Layout, error) {
+	if len(l.Data) == 0 {
+		return nil, NewError(ErrValidation, "layout data is empty")
+	}
+	var layout Layout
+	if err := json.Unmarshal(l.Data, &layout); err != nil {
+		return nil, NewErrorWithCause(ErrValidation, "invalid layout data", err)
+	}
+	if layout.ID == uuid.Nil {
+		layout.ID = l.LayoutID
+	}
+	return &layout, nil
+}
+
 // Grid represents the city grid dimensions
 type Grid struct {
 	Width  int `json:"width"`
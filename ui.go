@@ -20,6 +20,24 @@ func (c *UIClient) CreateLayout(ctx context.Context, layout *Layout) (*LayoutDB,
 	return &result, nil
 }
 
+// ListLayouts returns the active layouts of the account
+func (c *UIClient) ListLayouts(ctx context.Context) ([]LayoutDB, error) {
+	var layouts []LayoutDB
+	if err := c.http.Get(ctx, "/ui/layout", &layouts); err != nil {
+		return nil, err
+	}
+	return layouts, nil
+}
+
+// GetLayout returns a layout by ID
+func (c *UIClient) GetLayout(ctx context.Context, layoutID uuid.UUID) (*LayoutDB, error) {
+	var layout LayoutDB
+	if err := c.http.Get(ctx, "/ui/layout/"+layoutID.String(), &layout); err != nil {
+		return nil, err
+	}
+	return &layout, nil
+}
+
 // UpdateLayout is an alias for CreateLayout (upsert operation)
 func (c *UIClient) UpdateLayout(ctx context.Context, layout *Layout) (*LayoutDB, error) {
 	return c.CreateLayout(ctx, layout)
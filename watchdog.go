@@ -0,0 +1,170 @@
+package whooktown
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// WatchdogConfig configures a dead-man watchdog
+type WatchdogConfig struct {
+	// Timeout is the silence after which a sensor is marked offline
+	Timeout time.Duration
+
+	// Interval is how often sensors are checked (default: Timeout / 4)
+	Interval time.Duration
+
+	// OnOffline is called once when a sensor is marked offline, with the send
+	// error if any. A failed offline update is retried on later checks.
+	OnOffline func(id uuid.UUID, lastSeen time.Time, err error)
+
+	// OnRecover is called when a sensor marked offline is sent again
+	OnRecover func(id uuid.UUID)
+}
+
+// Watchdog marks sensors offline when their producers stop sending.
+// It tracks every Send made through the sensors client it is attached to.
+type Watchdog struct {
+	sensors *SensorsClient
+	config  WatchdogConfig
+
+	mu       sync.Mutex
+	lastSeen map[uuid.UUID]time.Time
+	offline  map[uuid.UUID]bool
+	unsent   map[uuid.UUID]bool // marked offline but the offline update failed
+}
+
+// NewWatchdog creates a watchdog and attaches it to the sensors client
+func NewWatchdog(sensors *SensorsClient, config WatchdogConfig) *Watchdog {
+	if config.Interval <= 0 {
+		config.Interval = config.Timeout / 4
+	}
+	if config.Interval <= 0 {
+		config.Interval = time.Second
+	}
+	w := &Watchdog{
+		sensors:  sensors,
+		config:   config,
+		lastSeen: make(map[uuid.UUID]time.Time),
+		offline:  make(map[uuid.UUID]bool),
+		unsent:   make(map[uuid.UUID]bool),
+	}
+	sensors.AddHook(w.observe)
+	return w
+}
+
+// Watch starts tracking a sensor that has not been sent yet
+func (w *Watchdog) Watch(id uuid.UUID) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.lastSeen[id]; !ok {
+		w.lastSeen[id] = time.Now()
+	}
+}
+
+// Forget stops tracking a sensor
+func (w *Watchdog) Forget(id uuid.UUID) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.lastSeen, id)
+	delete(w.offline, id)
+	delete(w.unsent, id)
+}
+
+// LastSeen returns the last time a sensor was sent
+func (w *Watchdog) LastSeen(id uuid.UUID) (time.Time, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	t, ok := w.lastSeen[id]
+	return t, ok
+}
+
+// IsOffline reports whether the watchdog has marked a sensor offline
+func (w *Watchdog) IsOffline(id uuid.UUID) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.offline[id]
+}
+
+// Run checks sensors every Interval until the context is cancelled
+func (w *Watchdog) Run(ctx context.Context) error {
+	ticker := time.NewTicker(w.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			w.Check(ctx)
+		}
+	}
+}
+
+// Check marks offline every sensor silent for longer than Timeout and
+// retries the offline updates that failed
+func (w *Watchdog) Check(ctx context.Context) {
+	now := time.Now()
+
+	w.mu.Lock()
+	var expired, retry []uuid.UUID
+	seen := make(map[uuid.UUID]time.Time)
+	for id, t := range w.lastSeen {
+		switch {
+		case w.unsent[id]:
+			retry = append(retry, id)
+		case !w.offline[id] && now.Sub(t) > w.config.Timeout:
+			w.offline[id] = true
+			expired = append(expired, id)
+		default:
+			continue
+		}
+		seen[id] = t
+	}
+	w.mu.Unlock()
+
+	for _, id := range retry {
+		w.markOffline(ctx, id, seen[id])
+	}
+	for _, id := range expired {
+		err := w.markOffline(ctx, id, seen[id])
+		if w.config.OnOffline != nil {
+			w.config.OnOffline(id, seen[id], err)
+		}
+	}
+}
+
+// markOffline sends the offline update of a sensor last seen at lastSeen
+func (w *Watchdog) markOffline(ctx context.Context, id uuid.UUID, lastSeen time.Time) error {
+	// Bypass policy and hooks: offline is authoritative and must not
+	// count as a sign of life
+	err := w.sensors.post(ctx, &SensorData{ID: id, Status: StatusOffline})
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	// A send since the check means the sensor is back
+	if w.offline[id] && w.lastSeen[id].Equal(lastSeen) {
+		if err != nil {
+			w.unsent[id] = true
+		} else {
+			delete(w.unsent, id)
+		}
+	}
+	return err
+}
+
+// observe records a send; registered as a SendHook
+func (w *Watchdog) observe(data *SensorData, _ error) {
+	w.mu.Lock()
+	w.lastSeen[data.ID] = time.Now()
+	recovered := w.offline[data.ID]
+	delete(w.offline, data.ID)
+	delete(w.unsent, data.ID)
+	w.mu.Unlock()
+
+	if recovered && w.config.OnRecover != nil {
+		w.config.OnRecover(data.ID)
+	}
+}
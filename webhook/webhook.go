@@ -0,0 +1,260 @@
+// Package webhook bridges arbitrary inbound JSON webhooks (Grafana, Uptime Kuma,
+// CI systems...) to whooktown sensor updates using path expressions.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	whooktown "github.com/fredericalix/whooktown-golang-sdk"
+	"github.com/fredericalix/whooktown-golang-sdk/jsonpath"
+	"github.com/gofrs/uuid"
+)
+
+// maxPayloadSize bounds the size of an accepted webhook body
+const maxPayloadSize = 4 << 20
+
+// ValueMapping extracts a value from the payload for a sensor field
+type ValueMapping struct {
+	// Path is a jsonpath expression, e.g. "$.alerts[0].state"
+	Path string `json:"path"`
+
+	// Values translates extracted values, e.g. {"alerting": "critical", "ok": "online"}
+	Values map[string]string `json:"values,omitempty"`
+
+	// Default is used when the path is missing or null, or its value is not in Values
+	Default string `json:"default,omitempty"`
+
+	// Format is a fmt format applied to the value for text fields, e.g. "%v orders"
+	Format string `json:"format,omitempty"`
+
+	path *jsonpath.Path
+}
+
+// Config configures a bridge
+type Config struct {
+	// SensorID is the sensor receiving every update, unless SensorPath is set
+	SensorID uuid.UUID `json:"sensor_id,omitempty"`
+
+	// SensorPath extracts the sensor from the payload. The value is looked up
+	// in Sensors, or must be a UUID when Sensors is empty.
+	SensorPath string               `json:"sensor_path,omitempty"`
+	Sensors    map[string]uuid.UUID `json:"sensors,omitempty"`
+
+	// Fields maps SensorData JSON field names (status, activity, towerText,
+	// amount...) to values extracted from the payload. Unknown names are rejected.
+	Fields map[string]*ValueMapping `json:"fields"`
+
+	// Secret enables HMAC-SHA256 verification of the raw body
+	Secret string `json:"secret,omitempty"`
+	// SignatureHeader carries the hex signature (default: "X-Signature-256")
+	SignatureHeader string `json:"signature_header,omitempty"`
+	// SignaturePrefix is stripped from the header value, e.g. "sha256="
+	SignaturePrefix string `json:"signature_prefix,omitempty"`
+
+	// OnError is called when a payload cannot be mapped or sent
+	OnError func(err error) `json:"-"`
+}
+
+// Bridge is an http.Handler mapping JSON webhook payloads to sensor updates
+type Bridge struct {
+	sensors    whooktown.SensorSender
+	config     Config
+	sensorPath *jsonpath.Path
+}
+
+// New validates the configuration and creates a bridge sending to sensors
+func New(sensors whooktown.SensorSender, config Config) (*Bridge, error) {
+	if config.SignatureHeader == "" {
+		config.SignatureHeader = "X-Signature-256"
+	}
+	if config.SensorID == uuid.Nil && config.SensorPath == "" {
+		return nil, whooktown.NewError(whooktown.ErrValidation, "webhook sensor_id or sensor_path is required")
+	}
+
+	b := &Bridge{sensors: sensors}
+	if config.SensorPath != "" {
+		p, err := jsonpath.Compile(config.SensorPath)
+		if err != nil {
+			return nil, whooktown.NewErrorWithCause(whooktown.ErrValidation, "invalid sensor path", err)
+		}
+		b.sensorPath = p
+	}
+
+	fields := make(map[string]*ValueMapping, len(config.Fields))
+	for name, m := range config.Fields {
+		if m == nil {
+			continue
+		}
+		if err := whooktown.ValidateField(name); err != nil {
+			return nil, err
+		}
+		mapping := *m
+		if mapping.Path != "" {
+			p, err := jsonpath.Compile(mapping.Path)
+			if err != nil {
+				return nil, whooktown.NewErrorWithCause(whooktown.ErrValidation, fmt.Sprintf("invalid path for %s", name), err)
+			}
+			mapping.path = p
+		} else if mapping.Default == "" {
+			return nil, whooktown.NewError(whooktown.ErrValidation, fmt.Sprintf("field %s needs a path or a default", name))
+		}
+		fields[name] = &mapping
+	}
+	config.Fields = fields
+	b.config = config
+	return b, nil
+}
+
+// ServeHTTP implements http.Handler
+func (b *Bridge) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, req.Body, maxPayloadSize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "payload too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "failed to read payload", http.StatusBadRequest)
+		return
+	}
+	if !b.verify(req.Header.Get(b.config.SignatureHeader), body) {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	data, err := b.Map(body)
+	if err != nil {
+		b.reportError(err)
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err := b.sensors.Send(req.Context(), data); err != nil {
+		b.reportError(err)
+		http.Error(w, "failed to forward sensor data", http.StatusBadGateway)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// Map extracts a sensor update from a raw JSON payload
+func (b *Bridge) Map(body []byte) (*whooktown.SensorData, error) {
+	var doc interface{}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, whooktown.NewErrorWithCause(whooktown.ErrValidation, "invalid json payload", err)
+	}
+
+	id, err := b.resolveSensor(doc)
+	if err != nil {
+		return nil, err
+	}
+	data := &whooktown.SensorData{ID: id}
+
+	for name, m := range b.config.Fields {
+		value, ok := m.extract(doc)
+		if !ok {
+			continue
+		}
+		if err := data.SetField(name, value); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// resolveSensor returns the sensor ID targeted by a payload
+func (b *Bridge) resolveSensor(doc interface{}) (uuid.UUID, error) {
+	if b.sensorPath == nil {
+		return b.config.SensorID, nil
+	}
+	v, ok := b.sensorPath.Get(doc)
+	if !ok || v == nil {
+		if b.config.SensorID != uuid.Nil {
+			return b.config.SensorID, nil
+		}
+		return uuid.Nil, whooktown.NewError(whooktown.ErrValidation, fmt.Sprintf("payload has no %s", b.sensorPath))
+	}
+	key := jsonpath.String(v)
+	if len(b.config.Sensors) > 0 {
+		id, ok := b.config.Sensors[key]
+		if !ok {
+			return uuid.Nil, whooktown.NewError(whooktown.ErrValidation, fmt.Sprintf("no sensor mapped to %q", key))
+		}
+		return id, nil
+	}
+	id, err := uuid.FromString(key)
+	if err != nil {
+		return uuid.Nil, whooktown.NewErrorWithCause(whooktown.ErrValidation, fmt.Sprintf("invalid sensor id %q", key), err)
+	}
+	return id, nil
+}
+
+// extract returns the mapped value for a payload
+func (m *ValueMapping) extract(doc interface{}) (interface{}, bool) {
+	var value interface{}
+	found := false
+	if m.path != nil {
+		value, found = m.path.Get(doc)
+	}
+	// A null value is treated as missing
+	if value == nil {
+		found = false
+	}
+	if found && len(m.Values) > 0 {
+		translated, ok := m.Values[jsonpath.String(value)]
+		value, found = translated, ok
+	}
+	if !found {
+		if m.Default == "" {
+			return nil, false
+		}
+		value = m.Default
+	}
+
+	if n, ok := value.(json.Number); ok {
+		if f, err := n.Float64(); err == nil {
+			value = f
+		}
+	}
+	if m.Format != "" {
+		return fmt.Sprintf(m.Format, value), true
+	}
+	return value, true
+}
+
+// verify checks the HMAC signature of body when a secret is configured
+func (b *Bridge) verify(header string, body []byte) bool {
+	if b.config.Secret == "" {
+		return true
+	}
+	sig, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(header), b.config.SignaturePrefix))
+	if err != nil || len(sig) == 0 {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(b.config.Secret))
+	mac.Write(body)
+	return hmac.Equal(sig, mac.Sum(nil))
+}
+
+// reportError forwards an error to the configured handler
+func (b *Bridge) reportError(err error) {
+	if b.config.OnError != nil {
+		b.config.OnError(err)
+	}
+}